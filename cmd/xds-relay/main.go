@@ -0,0 +1,93 @@
+// Command xds-relay is the relay's CLI entry point: load its bootstrap
+// (and optional aggregation keyer) configuration from disk and serve until
+// terminated.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/envoyproxy/xds-relay/internal/app/server"
+	"github.com/envoyproxy/xds-relay/internal/pkg/util/yamlproto"
+	aggregationv1 "github.com/envoyproxy/xds-relay/pkg/api/aggregation/v1"
+	bootstrapv1 "github.com/envoyproxy/xds-relay/pkg/api/bootstrap/v1"
+)
+
+func main() {
+	var (
+		bootstrapPath = flag.String("bootstrap", "", "path to the bootstrap config file (required)")
+		keyerPath     = flag.String("aggregation-rules", "", "path to the aggregation keyer rules file (optional)")
+		logLevel      = flag.String("log-level", "info", "log level; overridden by the bootstrap file's logging.level if set")
+	)
+	flag.Parse()
+
+	if flag.NArg() != 1 || flag.Arg(0) != "serve" {
+		fmt.Fprintln(os.Stderr, "usage: xds-relay --bootstrap <path> [--aggregation-rules <path>] serve")
+		os.Exit(2)
+	}
+	if *bootstrapPath == "" {
+		fmt.Fprintln(os.Stderr, "--bootstrap is required")
+		os.Exit(2)
+	}
+
+	bootstrap, err := loadBootstrap(*bootstrapPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	keyerConfiguration, err := loadKeyerConfiguration(*keyerPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	if err := server.RunWithContext(ctx, cancel, bootstrap, keyerConfiguration, *logLevel, "serve"); err != nil {
+		fmt.Fprintln(os.Stderr, "xds-relay exited with error:", err)
+		os.Exit(1)
+	}
+}
+
+func loadBootstrap(path string) (*bootstrapv1.Bootstrap, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading bootstrap config: %w", err)
+	}
+	var bootstrap bootstrapv1.Bootstrap
+	if err := yamlproto.FromYAMLToBootstrapConfiguration(string(content), &bootstrap); err != nil {
+		return nil, fmt.Errorf("parsing bootstrap config: %w", err)
+	}
+	return &bootstrap, nil
+}
+
+// loadKeyerConfiguration returns nil when no path was given, so the relay
+// falls back to its node-ID-per-entry aggregation default (see
+// aggregationKeyFor) rather than requiring every deployment to author a
+// keyer rules file.
+func loadKeyerConfiguration(path string) (*aggregationv1.KeyerConfiguration, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading aggregation rules: %w", err)
+	}
+	var keyerConfiguration aggregationv1.KeyerConfiguration
+	if err := yamlproto.FromYAMLToKeyerConfiguration(string(content), &keyerConfiguration); err != nil {
+		return nil, fmt.Errorf("parsing aggregation rules: %w", err)
+	}
+	return &keyerConfiguration, nil
+}
@@ -0,0 +1,142 @@
+package functional
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AssertLiveness checks that every Envoy's listeners still serve the
+// harness's test upstream response. It returns the first error
+// encountered rather than failing fast, so a caller can report every dead
+// listener rather than just the first.
+func AssertLiveness(ctx context.Context, o *Orchestrator) error {
+	for _, envoy := range o.Envoys {
+		ok, failed := callLocalServices(envoy.ListenerBase, 1)
+		if ok == 0 || failed > 0 {
+			return fmt.Errorf("envoy %d: %d listeners alive, %d failed", envoy.Index, ok, failed)
+		}
+	}
+	return nil
+}
+
+func callLocalServices(basePort uint32, n int) (ok, failed int) {
+	client := http.Client{Timeout: 500 * time.Millisecond}
+	for i := 0; i < n; i++ {
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d", basePort+uint32(i)))
+		if err != nil {
+			failed++
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	return ok, failed
+}
+
+// AssertConsistency checks that the version_info every Envoy last
+// acknowledged for a given origin's resources matches the last snapshot
+// version that origin set -- the relay may take a moment to propagate an
+// update, but it must never propagate something other than the origin's
+// latest.
+func AssertConsistency(ctx context.Context, o *Orchestrator, origin *Origin) error {
+	want := origin.LastVersion()
+	for _, envoy := range o.Envoys {
+		got, err := envoyConfigDumpVersion(ctx, envoy)
+		if err != nil {
+			return fmt.Errorf("envoy %d: %w", envoy.Index, err)
+		}
+		if got != want {
+			return fmt.Errorf("envoy %d: observed version %q, origin %d last set %q", envoy.Index, got, origin.Index, want)
+		}
+	}
+	return nil
+}
+
+// envoyConfigDumpVersion reads the version_info Envoy's admin config dump
+// reports for its dynamic listeners.
+func envoyConfigDumpVersion(ctx context.Context, envoy *Envoy) (string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/config_dump?resource=dynamic_listeners", envoy.AdminPort), nil)
+	if err != nil {
+		return "", err
+	}
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// The admin config dump is large; we only need version_info off the
+	// first dynamic listener, so decode into an untyped shape rather than
+	// pulling in Envoy's admin proto types for one field.
+	var dump struct {
+		Configs []struct {
+			VersionInfo string `json:"version_info"`
+		} `json:"dynamic_listeners"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&dump); err != nil {
+		return "", err
+	}
+	if len(dump.Configs) == 0 {
+		return "", fmt.Errorf("no dynamic listeners reported")
+	}
+	return dump.Configs[0].VersionInfo, nil
+}
+
+// CollectArtifacts snapshots each Envoy's admin /stats and the relay's
+// metrics endpoint into scenarioDir, so a failed scenario leaves behind
+// enough to diagnose without rerunning it.
+func CollectArtifacts(ctx context.Context, o *Orchestrator, scenarioDir string) error {
+	if err := os.MkdirAll(scenarioDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, envoy := range o.Envoys {
+		if err := dumpHTTP(ctx, fmt.Sprintf("http://127.0.0.1:%d/stats", envoy.AdminPort),
+			filepath.Join(scenarioDir, fmt.Sprintf("envoy-%d-stats.txt", envoy.Index))); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(scenarioDir, fmt.Sprintf("envoy-%d.log", envoy.Index)), envoy.logs.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+
+	if o.Relay != nil {
+		_ = dumpHTTP(ctx, "http://"+o.Relay.addr+"/metrics", filepath.Join(scenarioDir, "relay-metrics.txt"))
+	}
+
+	return nil
+}
+
+func dumpHTTP(ctx context.Context, url, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The endpoint being unreachable (e.g. the relay was just killed by
+		// the scenario under test) is itself useful information, but
+		// shouldn't fail artifact collection for every other component.
+		return ioutil.WriteFile(dest, []byte(fmt.Sprintf("unreachable: %s\n", err.Error())), 0o644)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, body, 0o644)
+}
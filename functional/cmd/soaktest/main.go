@@ -0,0 +1,120 @@
+// Command soaktest runs the functional fault-injection scenarios
+// unattended and in a loop, for longer soak runs in CI than `go test` is
+// meant for. It shares the same Scenarios table and assertions as
+// `go test -tags=functional ./functional/...`; this binary just wraps that
+// table in a loop with a summary report instead of a single pass/fail run.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/envoyproxy/xds-relay/functional"
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+func main() {
+	var (
+		duration    = flag.Duration("duration", time.Hour, "how long to keep looping over scenarios")
+		artifactDir = flag.String("artifact-dir", "./soaktest-artifacts", "where to write per-scenario artifacts")
+		envoyBin    = flag.String("envoy", "envoy", "path to the envoy binary")
+		relayBin    = flag.String("relay", "xds-relay", "path to the xds-relay binary")
+	)
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	logger, err := log.New("info", "console")
+	if err != nil {
+		fmt.Println("failed to initialize logger:", err)
+		os.Exit(1)
+	}
+
+	passed, failed := 0, 0
+	for round := 0; ctx.Err() == nil; round++ {
+		for _, scenario := range functional.Scenarios {
+			if ctx.Err() != nil {
+				break
+			}
+			scenarioDir := filepath.Join(*artifactDir, fmt.Sprintf("round-%d", round), scenario.Name)
+			if err := runOnce(ctx, scenario, scenarioDir, *envoyBin, *relayBin, logger); err != nil {
+				failed++
+				logger.Error(ctx, "round %d scenario %q failed: %s", round, scenario.Name, err.Error())
+			} else {
+				passed++
+				logger.Info(ctx, "round %d scenario %q passed", round, scenario.Name)
+			}
+		}
+	}
+
+	logger.Info(ctx, "soak run finished: %d passed, %d failed", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runOnce(
+	ctx context.Context,
+	scenario functional.Scenario,
+	scenarioDir string,
+	envoyBin string,
+	relayBin string,
+	logger log.Logger,
+) error {
+	cfg := functional.Config{
+		NumEnvoys:         1,
+		NumOrigins:        1,
+		BasePort:          20000,
+		ArtifactDir:       scenarioDir,
+		EnvoyBinary:       envoyBin,
+		RelayBinary:       relayBin,
+		BootstrapPerEnvoy: "./testdata/envoy_bootstrap_%d.yaml",
+	}
+
+	o, err := functional.NewOrchestrator(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("standing up orchestrator: %w", err)
+	}
+	defer o.Stop()
+
+	if err := o.BumpSnapshot(o.Origins[0], 7, 9); err != nil {
+		return fmt.Errorf("publishing initial snapshot: %w", err)
+	}
+
+	recover, err := scenario.Inject(ctx, o)
+	if err != nil {
+		return fmt.Errorf("injecting fault: %w", err)
+	}
+	if recover != nil {
+		if err := recover(); err != nil {
+			return fmt.Errorf("recovering fault: %w", err)
+		}
+	}
+
+	time.Sleep(scenario.SettleTimeout)
+
+	if err := functional.CollectArtifacts(ctx, o, scenarioDir); err != nil {
+		logger.Warn(ctx, "failed to collect artifacts: %s", err.Error())
+	}
+
+	if err := functional.AssertLiveness(ctx, o); err != nil {
+		return fmt.Errorf("liveness check failed: %w", err)
+	}
+	if err := functional.AssertConsistency(ctx, o, o.Origins[0]); err != nil {
+		return fmt.Errorf("consistency check failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// +build functional
+
+package functional
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// TestFaultScenarios runs every entry in Scenarios against a freshly
+// stood-up constellation, asserting liveness and consistency after each.
+// This is the regression net for the caching/aggregation logic: unlike the
+// single happy-path docker e2e test, each scenario here exercises a
+// specific failure mode of the relay rather than just the steady state.
+func TestFaultScenarios(t *testing.T) {
+	artifactRoot := os.Getenv("FUNCTIONAL_ARTIFACT_DIR")
+	if artifactRoot == "" {
+		artifactRoot = filepath.Join(os.TempDir(), "xds-relay-functional")
+	}
+
+	for _, scenario := range Scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cfg := Config{
+				NumEnvoys:         1,
+				NumOrigins:        1,
+				BasePort:          20000,
+				ArtifactDir:       filepath.Join(artifactRoot, scenario.Name),
+				EnvoyBinary:       envoyBinaryOrSkip(t),
+				RelayBinary:       relayBinaryOrSkip(t),
+				BootstrapPerEnvoy: "./testdata/envoy_bootstrap_%d.yaml",
+			}
+
+			o, err := NewOrchestrator(ctx, cfg, log.MockLogger)
+			if err != nil {
+				t.Fatalf("failed to stand up orchestrator: %s", err)
+			}
+			defer o.Stop()
+
+			if err := o.BumpSnapshot(o.Origins[0], 7, 9); err != nil {
+				t.Fatalf("failed to publish initial snapshot: %s", err)
+			}
+
+			recover, err := scenario.Inject(ctx, o)
+			if err != nil {
+				t.Fatalf("fault injection failed: %s", err)
+			}
+			if recover != nil {
+				if err := recover(); err != nil {
+					t.Fatalf("fault recovery failed: %s", err)
+				}
+			}
+
+			time.Sleep(scenario.SettleTimeout)
+
+			if err := CollectArtifacts(ctx, o, cfg.ArtifactDir); err != nil {
+				t.Logf("failed to collect artifacts: %s", err)
+			}
+
+			if err := AssertLiveness(ctx, o); err != nil {
+				t.Errorf("liveness check failed: %s", err)
+			}
+			if err := AssertConsistency(ctx, o, o.Origins[0]); err != nil {
+				t.Errorf("consistency check failed: %s", err)
+			}
+		})
+	}
+}
+
+func envoyBinaryOrSkip(t *testing.T) string {
+	path, err := exec.LookPath("envoy")
+	if err != nil {
+		t.Skip("envoy binary not found in PATH")
+	}
+	return path
+}
+
+func relayBinaryOrSkip(t *testing.T) string {
+	path, err := exec.LookPath("xds-relay")
+	if err != nil {
+		t.Skip("xds-relay binary not found in PATH; build it with `make build` first")
+	}
+	return path
+}
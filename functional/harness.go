@@ -0,0 +1,262 @@
+// Package functional implements a fault-injection test harness for
+// xds-relay, modeled after etcd's functional tester
+// (tests/functional in the etcd repo): stand up a small constellation of
+// Envoys, origin control planes, and a relay, then script faults against
+// them and assert the system recovers.
+//
+// It's meant to be run either as `go test -tags=functional ./functional/...`
+// for CI regression coverage, or as the standalone binary under
+// functional/cmd/soaktest for longer unattended soak runs.
+package functional
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	gcpcachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	gcpresourcev2 "github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+	bootstrapv1 "github.com/envoyproxy/xds-relay/pkg/api/bootstrap/v1"
+)
+
+// Config describes the size and layout of a functional test run.
+type Config struct {
+	NumEnvoys        int
+	NumOrigins       int
+	BasePort         uint32
+	ArtifactDir      string
+	EnvoyBinary      string
+	RelayBinary      string
+	BootstrapPerEnvoy string // path template, formatted with the envoy index
+}
+
+// Envoy is a running Envoy process under test.
+type Envoy struct {
+	Index       int
+	AdminPort   uint32
+	ListenerBase uint32
+	cmd         *exec.Cmd
+	logs        bytes.Buffer
+}
+
+// Origin is a go-control-plane snapshot cache standing in for an upstream
+// management server.
+type Origin struct {
+	Index   int
+	Port    uint32
+	Cache   gcpcachev2.SnapshotCache
+	Version int
+	cancel  context.CancelFunc
+	frozen  bool
+}
+
+// Relay is the xds-relay process under test, started as a real child
+// process (not in-process) so it can be killed and restarted the same way
+// an operator's process supervisor would.
+type Relay struct {
+	cmd  *exec.Cmd
+	addr string
+}
+
+// Orchestrator owns the lifecycle of every component in a functional run.
+type Orchestrator struct {
+	cfg     Config
+	logger  log.Logger
+	Envoys  []*Envoy
+	Origins []*Origin
+	Relay   *Relay
+
+	mu sync.Mutex
+}
+
+// NewOrchestrator stands up NumOrigins origin servers, NumEnvoys Envoys,
+// and one relay instance wired to aggregate across all origins.
+func NewOrchestrator(ctx context.Context, cfg Config, logger log.Logger) (*Orchestrator, error) {
+	if err := os.MkdirAll(cfg.ArtifactDir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating artifact dir: %w", err)
+	}
+
+	o := &Orchestrator{cfg: cfg, logger: logger}
+
+	for i := 0; i < cfg.NumOrigins; i++ {
+		origin, err := o.startOrigin(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		o.Origins = append(o.Origins, origin)
+	}
+
+	relay, err := o.startRelay(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.Relay = relay
+
+	for i := 0; i < cfg.NumEnvoys; i++ {
+		envoy, err := o.startEnvoy(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		o.Envoys = append(o.Envoys, envoy)
+	}
+
+	return o, nil
+}
+
+func (o *Orchestrator) startOrigin(ctx context.Context, index int) (*Origin, error) {
+	originCtx, cancel := context.WithCancel(ctx)
+	port := o.cfg.BasePort + uint32(1000+index)
+	cache := gcpcachev2.NewSnapshotCache(false, gcpcachev2.IDHash{}, originLogger{o.logger.Named(fmt.Sprintf("origin-%d", index))})
+
+	go runOriginServer(originCtx, cache, port)
+
+	return &Origin{Index: index, Port: port, Cache: cache, cancel: cancel}, nil
+}
+
+func (o *Orchestrator) startRelay(ctx context.Context) (*Relay, error) {
+	addr := fmt.Sprintf("127.0.0.1:%d", o.cfg.BasePort)
+	if err := o.writeRelayBootstrap(); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, o.cfg.RelayBinary, "--bootstrap", o.relayBootstrapPath(), "serve")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting relay: %w", err)
+	}
+	return &Relay{cmd: cmd, addr: addr}, nil
+}
+
+func (o *Orchestrator) relayBootstrapPath() string {
+	return filepath.Join(o.cfg.ArtifactDir, "relay-bootstrap.yaml")
+}
+
+// writeRelayBootstrap renders the relay's bootstrap config for this run and
+// writes it to relayBootstrapPath, so the child relay process started by
+// startRelay has something to load: a listener on BasePort, and an origin
+// cluster pointing at every Origin this orchestrator has already started.
+func (o *Orchestrator) writeRelayBootstrap() error {
+	endpoints := make([]*bootstrapv1.Server, 0, len(o.Origins))
+	for _, origin := range o.Origins {
+		endpoints = append(endpoints, &bootstrapv1.Server{Address: "127.0.0.1", Port: origin.Port})
+	}
+
+	bootstrap := &bootstrapv1.Bootstrap{
+		Server: &bootstrapv1.Server{Address: "127.0.0.1", Port: o.cfg.BasePort},
+		OriginServer: &bootstrapv1.OriginServer{
+			Cluster: []*bootstrapv1.Locality{
+				{Name: "origin", Endpoints: endpoints},
+			},
+		},
+	}
+
+	content, err := yaml.Marshal(bootstrap)
+	if err != nil {
+		return fmt.Errorf("marshaling relay bootstrap config: %w", err)
+	}
+	if err := ioutil.WriteFile(o.relayBootstrapPath(), content, 0o644); err != nil {
+		return fmt.Errorf("writing relay bootstrap config: %w", err)
+	}
+	return nil
+}
+
+func (o *Orchestrator) startEnvoy(ctx context.Context, index int) (*Envoy, error) {
+	adminPort := o.cfg.BasePort + uint32(2000+index)
+	listenerBase := o.cfg.BasePort + uint32(3000+index*100)
+	bootstrapPath := fmt.Sprintf(o.cfg.BootstrapPerEnvoy, index)
+
+	cmd := exec.CommandContext(ctx, o.cfg.EnvoyBinary, "-c", bootstrapPath, "--log-level", "warn")
+	envoy := &Envoy{Index: index, AdminPort: adminPort, ListenerBase: listenerBase, cmd: cmd}
+	cmd.Stdout = &envoy.logs
+	cmd.Stderr = &envoy.logs
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting envoy %d: %w", index, err)
+	}
+	return envoy, nil
+}
+
+// KillRelay sends SIGKILL to the relay process.
+func (o *Orchestrator) KillRelay() error {
+	if o.Relay == nil || o.Relay.cmd.Process == nil {
+		return fmt.Errorf("relay is not running")
+	}
+	return o.Relay.cmd.Process.Signal(syscall.SIGKILL)
+}
+
+// RestartRelay starts a fresh relay process after KillRelay.
+func (o *Orchestrator) RestartRelay(ctx context.Context) error {
+	relay, err := o.startRelay(ctx)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.Relay = relay
+	o.mu.Unlock()
+	return nil
+}
+
+// BumpSnapshot publishes a new, consistent snapshot on the given origin.
+func (o *Orchestrator) BumpSnapshot(origin *Origin, nClusters, nListeners int) error {
+	origin.Version++
+	snapshotConfig := gcpresourcev2.TestSnapshot{
+		Xds:              "xds",
+		UpstreamPort:     uint32(8080),
+		BasePort:         origin.Port + 5000,
+		NumClusters:      nClusters,
+		NumHTTPListeners: nListeners,
+		Version:          fmt.Sprintf("v%d", origin.Version),
+	}
+	snapshot := snapshotConfig.Generate()
+	if err := snapshot.Consistent(); err != nil {
+		return fmt.Errorf("origin %d: generated inconsistent snapshot: %w", origin.Index, err)
+	}
+	return origin.Cache.SetSnapshot(fmt.Sprintf("envoy-%d", origin.Index), snapshot)
+}
+
+// LastVersion returns the version_info of the last snapshot this origin
+// set, for consistency assertions.
+func (o *Origin) LastVersion() string {
+	return fmt.Sprintf("v%d", o.Version)
+}
+
+// EnvoyAlive reports whether an Envoy's admin endpoint is still serving,
+// the cheapest liveness signal available short of exercising a listener.
+func EnvoyAlive(ctx context.Context, envoy *Envoy) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/ready", envoy.AdminPort), nil)
+	if err != nil {
+		return false
+	}
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Stop tears down every component the orchestrator started.
+func (o *Orchestrator) Stop() {
+	for _, origin := range o.Origins {
+		origin.cancel()
+	}
+	if o.Relay != nil && o.Relay.cmd.Process != nil {
+		_ = o.Relay.cmd.Process.Kill()
+	}
+	for _, envoy := range o.Envoys {
+		if envoy.cmd.Process != nil {
+			_ = envoy.cmd.Process.Kill()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package functional
+
+import (
+	"context"
+	"fmt"
+
+	gcpcachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	gcpserverv2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	gcpserverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	gcptest "github.com/envoyproxy/go-control-plane/pkg/test"
+	gcpresourcev2 "github.com/envoyproxy/go-control-plane/pkg/test/resource/v2"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// sendMalformedSnapshot attempts to publish a snapshot with zero listeners
+// but a non-zero cluster count, which go-control-plane's Consistent()
+// rejects (every cluster is expected to have a corresponding listener in
+// this test topology). It returns the Consistent() error without ever
+// calling SetSnapshot, exercising the same "reject garbage before the
+// relay sees it" path a malformed upstream response would hit.
+func sendMalformedSnapshot(o *Origin) error {
+	snapshot := gcpresourcev2.TestSnapshot{
+		Xds:              "xds",
+		UpstreamPort:     8080,
+		BasePort:         o.Port + 5000,
+		NumClusters:      7,
+		NumHTTPListeners: 0,
+		Version:          fmt.Sprintf("v%d-malformed", o.Version+1),
+	}.Generate()
+	return snapshot.Consistent()
+}
+
+// runOriginServer serves a snapshot cache as a gRPC management server,
+// standing in for a real origin control plane. It blocks until ctx is
+// canceled, so callers run it in a goroutine.
+func runOriginServer(ctx context.Context, cache gcpcachev2.SnapshotCache, port uint32) {
+	srv2 := gcpserverv2.NewServer(ctx, cache, nil)
+	srv3 := gcpserverv3.NewServer(ctx, nil, nil)
+	gcptest.RunManagementServer(ctx, srv2, srv3, uint(port))
+}
+
+// originLogger adapts xds-relay's log.Logger to the gcplog.Logger
+// interface expected by go-control-plane's snapshot cache.
+type originLogger struct {
+	logger log.Logger
+}
+
+func (l originLogger) Debugf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Debug(context.Background(), format, args...)
+}
+
+func (l originLogger) Infof(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Info(context.Background(), format, args...)
+}
+
+func (l originLogger) Warnf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Warn(context.Background(), format, args...)
+}
+
+func (l originLogger) Errorf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Error(context.Background(), format, args...)
+}
@@ -0,0 +1,149 @@
+package functional
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Scenario is a single fault to inject and recover from, plus how long to
+// wait for the system to settle before asserting liveness and consistency.
+// New faults are added as one table entry here rather than a new test
+// function, so the liveness/consistency assertions stay uniform across
+// every scenario.
+type Scenario struct {
+	Name string
+
+	// Inject performs the fault. It returns a Recover func that undoes it
+	// (restarting a killed process, removing an iptables rule, unpausing a
+	// container); Recover may be a no-op for faults that self-heal (e.g. a
+	// single malformed response).
+	Inject func(ctx context.Context, o *Orchestrator) (recover func() error, err error)
+
+	// SettleTimeout bounds how long to wait, after Inject (and Recover, if
+	// any), for the relay and Envoys to converge before the harness checks
+	// liveness/consistency.
+	SettleTimeout time.Duration
+}
+
+// Scenarios is the full fault-injection table the harness runs through.
+var Scenarios = []Scenario{
+	{
+		Name:          "kill_relay_mid_stream",
+		SettleTimeout: 15 * time.Second,
+		Inject: func(ctx context.Context, o *Orchestrator) (func() error, error) {
+			if err := o.KillRelay(); err != nil {
+				return nil, err
+			}
+			return func() error { return o.RestartRelay(ctx) }, nil
+		},
+	},
+	{
+		Name:          "drop_upstream_tcp_connection",
+		SettleTimeout: 20 * time.Second,
+		Inject: func(ctx context.Context, o *Orchestrator) (func() error, error) {
+			if len(o.Origins) == 0 {
+				return nil, fmt.Errorf("no origins configured")
+			}
+			port := o.Origins[0].Port
+			if err := blockPort(port); err != nil {
+				return nil, err
+			}
+			return func() error { return unblockPort(port) }, nil
+		},
+	},
+	{
+		Name:          "freeze_origin",
+		SettleTimeout: 20 * time.Second,
+		Inject: func(ctx context.Context, o *Orchestrator) (func() error, error) {
+			if len(o.Origins) == 0 {
+				return nil, fmt.Errorf("no origins configured")
+			}
+			origin := o.Origins[0]
+			if err := pauseContainer(originContainerName(origin)); err != nil {
+				return nil, err
+			}
+			origin.frozen = true
+			return func() error {
+				origin.frozen = false
+				return unpauseContainer(originContainerName(origin))
+			}, nil
+		},
+	},
+	{
+		Name:          "flap_origin_snapshots",
+		SettleTimeout: 10 * time.Second,
+		Inject: func(ctx context.Context, o *Orchestrator) (func() error, error) {
+			if len(o.Origins) == 0 {
+				return nil, fmt.Errorf("no origins configured")
+			}
+			origin := o.Origins[0]
+			flapCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			go func() {
+				ticker := time.NewTicker(20 * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-flapCtx.Done():
+						return
+					case <-ticker.C:
+						_ = o.BumpSnapshot(origin, 7, 9)
+					}
+				}
+			}()
+			return func() error { cancel(); return nil }, nil
+		},
+	},
+	{
+		Name:          "malformed_origin_snapshot",
+		SettleTimeout: 10 * time.Second,
+		Inject: func(ctx context.Context, o *Orchestrator) (func() error, error) {
+			if len(o.Origins) == 0 {
+				return nil, fmt.Errorf("no origins configured")
+			}
+			origin := o.Origins[0]
+			// An inconsistent snapshot (a listener referencing a cluster
+			// that isn't in the same snapshot) is the SotW equivalent of a
+			// NACK-worthy response: go-control-plane's cache rejects it
+			// before it ever reaches the relay, so this asserts the origin
+			// sending garbage can't wedge the relay's existing, valid
+			// snapshot.
+			if err := sendMalformedSnapshot(origin); err == nil {
+				return nil, fmt.Errorf("expected malformed snapshot to be rejected, but it was accepted")
+			}
+			return func() error { return o.BumpSnapshot(origin, 7, 9) }, nil
+		},
+	},
+}
+
+// originContainerName is the docker container name convention the harness
+// expects origin servers to be run under when faults that require
+// container-level control (freeze/pause) are exercised. Origins started
+// in-process via startOrigin (the default for CI) don't have a container
+// to pause; freeze_origin is intended for a soak run configuration where
+// origins are launched as separate containers instead.
+func originContainerName(o *Origin) string {
+	return fmt.Sprintf("xds-relay-functional-origin-%d", o.Index)
+}
+
+// blockPort and unblockPort use an iptables-based proxy to simulate a
+// dropped upstream TCP connection without actually killing the origin
+// process: incoming packets on the port are rejected, so in-flight gRPC
+// streams see a connection reset the same way they would against a real
+// network partition.
+func blockPort(port uint32) error {
+	return exec.Command("iptables", "-A", "INPUT", "-p", "tcp", "--dport", fmt.Sprint(port), "-j", "DROP").Run()
+}
+
+func unblockPort(port uint32) error {
+	return exec.Command("iptables", "-D", "INPUT", "-p", "tcp", "--dport", fmt.Sprint(port), "-j", "DROP").Run()
+}
+
+func pauseContainer(name string) error {
+	return exec.Command("docker", "pause", name).Run()
+}
+
+func unpauseContainer(name string) error {
+	return exec.Command("docker", "unpause", name).Run()
+}
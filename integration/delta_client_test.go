@@ -0,0 +1,127 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/xds-relay/internal/app/upstream"
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+const deltaOriginServerPort = 19002
+
+// deltaOriginServer is a minimal hand-rolled Delta ADS origin. go-control-plane
+// v0.9.8, the version this relay is pinned to, never implemented the Delta rpc
+// on its snapshot cache server -- DeltaAggregatedResources there always
+// returns "not implemented" -- so there's no fixture in that dependency this
+// test can run against. This implements just enough of one to exercise
+// upstream.Client.OpenDeltaStream end to end, including across a second push:
+// the second send only happens once the client has re-sent its request,
+// which is what actually exercises the client re-arming its watch after the
+// first response rather than just its initial stream setup.
+type deltaOriginServer struct {
+	discoveryv2.UnimplementedAggregatedDiscoveryServiceServer
+}
+
+func (*deltaOriginServer) DeltaAggregatedResources(
+	stream discoveryv2.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	if err := stream.Send(deltaClusterResponse("v0", "cluster-0")); err != nil {
+		return err
+	}
+
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	return stream.Send(deltaClusterResponse("v1", "cluster-1"))
+}
+
+func deltaClusterResponse(version, clusterName string) *v2.DeltaDiscoveryResponse {
+	body, _ := ptypes.MarshalAny(&v2.Cluster{Name: clusterName})
+	return &v2.DeltaDiscoveryResponse{
+		TypeUrl:           upstream.ClusterTypeURL,
+		SystemVersionInfo: version,
+		Nonce:             version,
+		Resources: []*v2.Resource{{
+			Name:     clusterName,
+			Version:  version,
+			Resource: body,
+		}},
+	}
+}
+
+// TestXdsClientGetsDeltaResponsesFromUpstreamServer exercises
+// upstream.Client.OpenDeltaStream end to end against a hand-rolled Delta
+// origin (see deltaOriginServer), mirroring
+// TestXdsClientGetsIncrementalResponsesFromUpstreamServer but over the Delta
+// rpc.
+func TestXdsClientGetsDeltaResponsesFromUpstreamServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", deltaOriginServerPort))
+	if err != nil {
+		assert.Fail(t, "listen failed: %s", err.Error())
+		return
+	}
+	grpcServer := grpc.NewServer()
+	discoveryv2.RegisterAggregatedDiscoveryServiceServer(grpcServer, &deltaOriginServer{})
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	client, err := upstream.New(
+		ctx,
+		[]string{strings.Join([]string{"127.0.0.1", strconv.Itoa(deltaOriginServerPort)}, ":")},
+		upstream.CallOptions{Timeout: time.Minute},
+		log.MockLogger)
+	if err != nil {
+		assert.Fail(t, "NewClient failed: %s", err.Error())
+		return
+	}
+
+	respCh, shutdown, err := client.OpenDeltaStream(&v2.DeltaDiscoveryRequest{
+		TypeUrl: upstream.ClusterTypeURL,
+		Node: &corev2.Node{
+			Id: nodeID,
+		},
+	})
+	if err != nil {
+		assert.Fail(t, "OpenDeltaStream failed: %s", err.Error())
+		return
+	}
+	defer shutdown()
+
+	select {
+	case resp := <-respCh:
+		assert.NotNil(t, resp)
+		assert.Equal(t, "v0", resp.Nonce)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timeout waiting for the first delta response")
+		return
+	}
+
+	select {
+	case resp := <-respCh:
+		assert.NotNil(t, resp)
+		assert.Equal(t, "v1", resp.Nonce)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timeout waiting for the second delta response")
+	}
+}
@@ -32,10 +32,31 @@ import (
 
 var testLogger = log.MockLogger.Named("e2e")
 
+// helloMessage is the body the test's upstream HTTP service returns, which
+// Envoy is expected to proxy through verbatim. Earlier go-control-plane
+// versions exposed this (and a RunHTTP helper to serve it) as
+// pkg/test.Hello/pkg/test.RunHTTP; both were dropped by v0.9.8, the version
+// this relay is pinned to, so runHTTPEcho below is a minimal stand-in for
+// just the part of that package this test actually needs.
+const helloMessage = "Hi, there!"
+
+// runHTTPEcho serves helloMessage on port until ctx is canceled.
+func runHTTPEcho(ctx context.Context, port uint) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(helloMessage))
+	})
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		testLogger.Fatal(ctx, "upstream http echo server failed: %s", err.Error())
+	}
+}
+
 func TestMain(m *testing.M) {
-	// We force a 1 second sleep before running a test to let the OS close any lingering socket from previous
-	// tests.
-	time.Sleep(1 * time.Second)
 	code := m.Run()
 	os.Exit(code)
 }
@@ -65,7 +86,7 @@ func TestSnapshotCacheSingleEnvoyAndXdsRelayServer(t *testing.T) {
 
 	// We run a service that returns the string "Hi, there!" locally and expose it through envoy.
 	// This is the service that Envoy will make requests to.
-	go gcptest.RunHTTP(ctx, httpServicePort)
+	go runHTTPEcho(ctx, httpServicePort)
 
 	// Mimic a management server using go-control-plane's snapshot cache.
 	managementServer, signal := startSnapshotCache(ctx, managementServerPort)
@@ -148,7 +169,23 @@ func startXdsRelayServer(ctx context.Context, cancel context.CancelFunc, bootstr
 	if err != nil {
 		testLogger.Fatal(ctx, "failed to translate aggregation rules: ", err)
 	}
-	go server.RunWithContext(ctx, cancel, &bootstrapConfig, &aggregationRulesConfig, "debug", "serve")
+	relay, err := server.NewRelay(&bootstrapConfig, &aggregationRulesConfig, "debug")
+	if err != nil {
+		testLogger.Fatal(ctx, "failed to build xds-relay server: %s", err.Error())
+	}
+
+	go func() {
+		if err := relay.Serve(ctx); err != nil && ctx.Err() == nil {
+			testLogger.Fatal(ctx, "xds-relay server exited unexpectedly: %s", err.Error())
+		}
+		cancel()
+	}()
+
+	select {
+	case <-relay.Ready():
+	case <-time.After(10 * time.Second):
+		testLogger.Fatal(ctx, "timed out waiting for xds-relay server to become ready")
+	}
 }
 
 func startEnvoy(ctx context.Context, bootstrapFilePath string, signal chan struct{}) bytes.Buffer {
@@ -196,8 +233,8 @@ func callLocalService(port uint, nListeners int) (int, int) {
 				ch <- err
 				return
 			}
-			if string(body) != gcptest.Hello {
-				ch <- fmt.Errorf("expected envoy response: %q, got: %q", gcptest.Hello, string(body))
+			if string(body) != helloMessage {
+				ch <- fmt.Errorf("expected envoy response: %q, got: %q", helloMessage, string(body))
 				return
 			}
 			ch <- nil
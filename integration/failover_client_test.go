@@ -0,0 +1,105 @@
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	gcpcachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	gcpserverv2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	gcpserverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	gcptest "github.com/envoyproxy/go-control-plane/pkg/test"
+	gcptestv2 "github.com/envoyproxy/go-control-plane/pkg/test/v2"
+	"github.com/stretchr/testify/assert"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/xds-relay/internal/app/upstream"
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+const (
+	failoverOriginAPort = 19003
+	failoverOriginBPort = 19004
+)
+
+// TestClientFailsOverWhenOneOriginIsKilled asserts that a Client configured
+// with two upstream endpoints keeps delivering updates on its existing
+// stream after the endpoint it's currently attached to is killed, as long
+// as the other endpoint stays up.
+func TestClientFailsOverWhenOneOriginIsKilled(t *testing.T) {
+	originACtx, originACancel := context.WithCancel(context.Background())
+	originBCtx, originBCancel := context.WithCancel(context.Background())
+	defer originACancel()
+	defer originBCancel()
+
+	_, configA := createSnapshotCache(updates, log.MockLogger)
+	snapshotB, configB := createSnapshotCache(updates, log.MockLogger)
+
+	cbA := gcptestv2.Callbacks{Signal: make(chan struct{})}
+	cbB := gcptestv2.Callbacks{Signal: make(chan struct{})}
+
+	startOrigin := func(ctx context.Context, port uint, configv2 gcpcachev2.SnapshotCache, cb *gcptestv2.Callbacks) {
+		srv2 := gcpserverv2.NewServer(ctx, configv2, cb)
+		srv3 := gcpserverv3.NewServer(ctx, nil, nil)
+		go gcptest.RunManagementServer(ctx, srv2, srv3, port)
+	}
+	startOrigin(originACtx, failoverOriginAPort, configA, &cbA)
+	startOrigin(originBCtx, failoverOriginBPort, configB, &cbB)
+
+	clientCtx, clientCancel := context.WithCancel(context.Background())
+	defer clientCancel()
+
+	endpoints := []string{
+		fmt.Sprintf("127.0.0.1:%d", failoverOriginAPort),
+		fmt.Sprintf("127.0.0.1:%d", failoverOriginBPort),
+	}
+	client, err := upstream.New(clientCtx, endpoints, upstream.CallOptions{Timeout: time.Minute}, log.MockLogger)
+	if err != nil {
+		assert.Fail(t, "NewClient failed: %s", err.Error())
+		return
+	}
+
+	respCh, _, err := client.OpenStream(&v2.DiscoveryRequest{
+		TypeUrl: upstream.ClusterTypeURL,
+		Node:    &corev2.Node{Id: nodeID},
+	})
+	if err != nil {
+		assert.Fail(t, "OpenStream failed: %s", err.Error())
+		return
+	}
+
+	// Wait for the initial request to land on whichever origin the client
+	// happened to dial first.
+	select {
+	case <-cbA.Signal:
+	case <-cbB.Signal:
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "timeout waiting for the first request")
+		return
+	}
+
+	// Kill origin A. If the client had attached to it, the stream must
+	// re-dial against origin B rather than going silent.
+	originACancel()
+
+	sendResponses(originBCtx, log.MockLogger, updates, snapshotB, configB)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case resp, more := <-respCh:
+			assert.True(t, more)
+			assert.NotNil(t, resp)
+		case <-time.After(20 * time.Second):
+			assert.Fail(t, "stream did not fail over to the surviving origin in time")
+		}
+	}()
+	wg.Wait()
+}
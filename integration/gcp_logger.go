@@ -0,0 +1,29 @@
+package integration
+
+import (
+	"context"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// gcpLogger adapts xds-relay's log.Logger to the gcplog.Logger interface
+// expected by go-control-plane's snapshot cache.
+type gcpLogger struct {
+	logger log.Logger
+}
+
+func (l gcpLogger) Debugf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Debug(context.Background(), format, args...)
+}
+
+func (l gcpLogger) Infof(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Info(context.Background(), format, args...)
+}
+
+func (l gcpLogger) Warnf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Warn(context.Background(), format, args...)
+}
+
+func (l gcpLogger) Errorf(format string, args ...interface{}) {
+	l.logger.With("component", "go-control-plane").Error(context.Background(), format, args...)
+}
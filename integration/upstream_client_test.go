@@ -151,16 +151,16 @@ func TestClientContextCancellationShouldCloseAllResponseChannels(t *testing.T) {
 	clientCtx, clientCancel := context.WithCancel(context.Background())
 	client, err := upstream.New(
 		clientCtx,
-		strings.Join([]string{"127.0.0.1", strconv.Itoa(originServerPort)}, ":"),
+		[]string{strings.Join([]string{"127.0.0.1", strconv.Itoa(originServerPort)}, ":")},
 		upstream.CallOptions{Timeout: time.Minute},
 		log.MockLogger)
-	respCh1, _, _ := client.OpenStream(v2.DiscoveryRequest{
+	respCh1, _, _ := client.OpenStream(&v2.DiscoveryRequest{
 		TypeUrl: upstream.ClusterTypeURL,
 		Node: &corev2.Node{
 			Id: nodeID,
 		},
 	})
-	respCh2, _, _ := client.OpenStream(v2.DiscoveryRequest{
+	respCh2, _, _ := client.OpenStream(&v2.DiscoveryRequest{
 		TypeUrl: upstream.ClusterTypeURL,
 		Node: &corev2.Node{
 			Id: nodeID,
@@ -206,7 +206,7 @@ func setup(
 
 	client, err := upstream.New(
 		context.Background(),
-		strings.Join([]string{"127.0.0.1", strconv.Itoa(originServerPort)}, ":"),
+		[]string{strings.Join([]string{"127.0.0.1", strconv.Itoa(originServerPort)}, ":")},
 		upstream.CallOptions{Timeout: time.Minute},
 		logger)
 	if err != nil {
@@ -214,7 +214,7 @@ func setup(
 		return nil, nil, err
 	}
 
-	respCh, shutdown, err := client.OpenStream(v2.DiscoveryRequest{
+	respCh, shutdown, err := client.OpenStream(&v2.DiscoveryRequest{
 		TypeUrl: upstream.ClusterTypeURL,
 		Node: &corev2.Node{
 			Id: nodeID,
@@ -0,0 +1,75 @@
+// Package admin implements xds-relay's admin HTTP endpoint: operational
+// surface for health probes and metrics scraping, separate from the xDS
+// gRPC listener Envoys talk to.
+package admin
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// Server is the admin HTTP server. It implements service.Service.
+type Server struct {
+	address string
+	mux     *http.ServeMux
+	logger  log.Logger
+	ready   chan struct{}
+}
+
+// New creates an admin Server that will bind to address once Serve is
+// called.
+func New(address string, logger log.Logger) *Server {
+	s := &Server{
+		address: address,
+		mux:     http.NewServeMux(),
+		logger:  logger,
+		ready:   make(chan struct{}),
+	}
+	s.mux.HandleFunc("/ready", s.handleReady)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	return s
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// A placeholder text-format export; real counters get wired in as the
+	// components that own them (cache hit/miss, upstream dial attempts,
+	// active streams) are instrumented.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("# xds-relay admin metrics endpoint\n"))
+}
+
+// Ready is closed once the admin listener is bound and serving.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Serve binds the admin listener and serves until ctx is canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{Handler: s.mux}
+	close(s.ready)
+
+	go func() {
+		<-ctx.Done()
+		_ = httpServer.Close()
+	}()
+
+	s.logger.Info(ctx, "serving admin endpoint on %s", s.address)
+	err = httpServer.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+// Package cache implements xds-relay's aggregation cache: the component
+// that sits between many downstream Envoy streams and a single upstream
+// watch, fanning out whatever the upstream last sent to every subscriber
+// keyed under the same aggregation key.
+package cache
+
+import (
+	"sync"
+)
+
+// Resource is a single named xDS resource at a specific version, as last
+// observed from upstream. Body holds the wire-format resource payload
+// (an *any.Any in practice); it's left untyped here to keep the cache
+// itself version agnostic rather than importing a specific xDS version's
+// generated types.
+type Resource struct {
+	Name    string
+	Version string
+	Body    interface{}
+}
+
+// entry is the cached state for one aggregation key and type URL: the
+// latest known version of every resource upstream has sent.
+type entry struct {
+	mu        sync.RWMutex
+	resources map[string]Resource // resource name -> Resource
+}
+
+// Cache is the aggregation cache. It is keyed by (aggregation key, type
+// URL) and holds the latest resource set observed from upstream for each.
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]*entry // "<aggregationKey>/<typeURL>" -> entry
+}
+
+// New creates an empty Cache.
+func New() *Cache {
+	return &Cache{entries: make(map[string]*entry)}
+}
+
+func entryKey(aggregationKey, typeURL string) string {
+	return aggregationKey + "/" + typeURL
+}
+
+// SetResources replaces the full resource set known for an aggregation
+// key/type URL, as happens on a State-of-the-World snapshot update.
+func (c *Cache) SetResources(aggregationKey, typeURL string, resources map[string]Resource) {
+	e := c.entryFor(aggregationKey, typeURL)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resources = resources
+}
+
+// GetResources returns the latest known resource set for an aggregation
+// key/type URL.
+func (c *Cache) GetResources(aggregationKey, typeURL string) map[string]Resource {
+	e := c.entryFor(aggregationKey, typeURL)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make(map[string]Resource, len(e.resources))
+	for name, r := range e.resources {
+		out[name] = r
+	}
+	return out
+}
+
+func (c *Cache) entryFor(aggregationKey, typeURL string) *entry {
+	key := entryKey(aggregationKey, typeURL)
+
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		return e
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok = c.entries[key]
+	if !ok {
+		e = &entry{resources: make(map[string]Resource)}
+		c.entries[key] = e
+	}
+	return e
+}
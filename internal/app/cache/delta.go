@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription is the per-stream state a Delta xDS watch needs: which
+// resources the downstream has asked for, and the version it last
+// acknowledged for each. Unlike SotW, this state cannot be derived from the
+// node alone -- a single node may open several Delta streams, each free to
+// subscribe/unsubscribe independently (resource_names_subscribe /
+// resource_names_unsubscribe on any subsequent request) -- so it lives for
+// the lifetime of the stream, not the cache entry.
+type Subscription struct {
+	AggregationKey string
+	TypeURL        string
+
+	mu           sync.Mutex
+	wildcard     bool                // true until the downstream subscribes to specific resources
+	subscribed   map[string]struct{} // resource name -> subscribed; unused while wildcard
+	acked        map[string]string   // resource name -> last acked version
+	pendingNonce string
+}
+
+// NewSubscription creates per-stream subscription state seeded with the
+// resource names requested on the initial DeltaDiscoveryRequest. Per the
+// xDS protocol, an empty initialResourceNames means the downstream is
+// wildcard-subscribed to every resource of this type, not to none.
+func NewSubscription(aggregationKey, typeURL string, initialResourceNames []string) *Subscription {
+	subscribed := make(map[string]struct{}, len(initialResourceNames))
+	for _, name := range initialResourceNames {
+		subscribed[name] = struct{}{}
+	}
+	return &Subscription{
+		AggregationKey: aggregationKey,
+		TypeURL:        typeURL,
+		wildcard:       len(initialResourceNames) == 0,
+		subscribed:     subscribed,
+		acked:          make(map[string]string),
+	}
+}
+
+// Update applies a subsequent request's resource_names_subscribe/
+// resource_names_unsubscribe lists to the subscription. Explicitly
+// subscribing to any resource name ends wildcard mode, per the xDS
+// protocol: from that point the downstream only gets what it asks for.
+func (s *Subscription) Update(subscribe, unsubscribe []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(subscribe) > 0 {
+		s.wildcard = false
+	}
+	for _, name := range subscribe {
+		s.subscribed[name] = struct{}{}
+	}
+	for _, name := range unsubscribe {
+		delete(s.subscribed, name)
+		delete(s.acked, name)
+	}
+}
+
+// Ack records that the downstream has acknowledged the resources sent in
+// the response with the given nonce: resources in sent are recorded at the
+// version the cache last sent them at, and resources in removed are forgotten
+// entirely, since a removal the downstream has acked no longer needs to be
+// tracked as "previously acked" for Diff to re-report it.
+func (s *Subscription) Ack(nonce string, sent map[string]string, removed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if nonce != s.pendingNonce {
+		// Stale ack for a response that's since been superseded; ignore.
+		return
+	}
+	for name, version := range sent {
+		s.acked[name] = version
+	}
+	for _, name := range removed {
+		delete(s.acked, name)
+	}
+}
+
+// Nack records that the downstream rejected the response with the given
+// nonce. The resources it covered are left at their previously acked
+// version so the next Diff re-sends them -- it's the caller's
+// responsibility to actually compute and send that next Diff rather than
+// waiting for some unrelated trigger.
+func (s *Subscription) Nack(nonce string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if nonce != s.pendingNonce {
+		return
+	}
+}
+
+// MarkSent records the nonce of a Diff that was actually sent to the
+// downstream, so a subsequent Ack/Nack of that nonce is recognized as live
+// rather than stale. Callers that compute a Diff but decide not to send it
+// (e.g. because it has no delta and the subscription was already warmed)
+// must not call MarkSent, so the previous outstanding nonce stays valid.
+func (s *Subscription) MarkSent(nonce string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingNonce = nonce
+}
+
+// Diff is the outcome of comparing a Subscription's acked state against the
+// Cache's current resource set: the resources that need to be (re)sent and
+// the resources that need to be reported removed.
+type Diff struct {
+	Nonce    string
+	Changed  map[string]Resource // resource name -> new Resource
+	Removed  []string
+	HasDelta bool
+}
+
+var nonceCounter uint64
+
+func nextNonce() string {
+	return strconv.FormatUint(atomic.AddUint64(&nonceCounter, 1), 10)
+}
+
+// Diff computes what should be sent to a subscriber next: any subscribed
+// resource whose cached version differs from (or is absent from) the
+// version the subscriber last acked, plus any previously-acked resource
+// that has since been removed from the cache. In wildcard mode, "subscribed"
+// means every resource currently in the cache plus any the subscriber has
+// previously acked (so a removal is still reported even after the resource
+// itself is gone from the cache). Diff does not itself mark anything as
+// sent (see MarkSent) -- a caller that finds HasDelta false is free to skip
+// sending a response rather than round-tripping an empty one, except for
+// the very first Diff on a new subscription, which callers must still send
+// since an empty initial Delta response is how a newly-subscribed resource
+// set is reported "warmed up" with nothing to sync.
+func (c *Cache) Diff(sub *Subscription) Diff {
+	current := c.GetResources(sub.AggregationKey, sub.TypeURL)
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	diff := Diff{
+		Nonce:   nextNonce(),
+		Changed: make(map[string]Resource),
+	}
+
+	names := sub.subscribed
+	if sub.wildcard {
+		names = make(map[string]struct{}, len(current))
+		for name := range current {
+			names[name] = struct{}{}
+		}
+		for name := range sub.acked {
+			names[name] = struct{}{}
+		}
+	}
+
+	for name := range names {
+		resource, exists := current[name]
+		if !exists {
+			if _, wasAcked := sub.acked[name]; wasAcked {
+				diff.Removed = append(diff.Removed, name)
+				diff.HasDelta = true
+			}
+			continue
+		}
+		if ackedVersion, ok := sub.acked[name]; !ok || ackedVersion != resource.Version {
+			diff.Changed[name] = resource
+			diff.HasDelta = true
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffWildcardSubscriptionReportsEveryResourceOnce(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+		"b": {Name: "b", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+
+	diff := c.Diff(sub)
+
+	assert.True(t, diff.HasDelta)
+	assert.Len(t, diff.Changed, 2)
+	assert.Empty(t, diff.Removed)
+}
+
+func TestDiffOnlyReportsResourcesChangedSinceLastAck(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+		"b": {Name: "b", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+
+	first := c.Diff(sub)
+	sub.MarkSent(first.Nonce)
+	sub.Ack(first.Nonce, versionsOf(first), first.Removed)
+
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+		"b": {Name: "b", Version: "v2"},
+	})
+	second := c.Diff(sub)
+
+	assert.True(t, second.HasDelta)
+	assert.Len(t, second.Changed, 1)
+	assert.Equal(t, "v2", second.Changed["b"].Version)
+}
+
+func TestDiffReportsRemovalOfAPreviouslyAckedResource(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+	first := c.Diff(sub)
+	sub.MarkSent(first.Nonce)
+	sub.Ack(first.Nonce, versionsOf(first), first.Removed)
+
+	c.SetResources("key", "type", map[string]Resource{})
+	second := c.Diff(sub)
+
+	assert.True(t, second.HasDelta)
+	assert.Equal(t, []string{"a"}, second.Removed)
+}
+
+func TestAckOfStaleNonceIsIgnored(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+	first := c.Diff(sub)
+	sub.MarkSent(first.Nonce)
+
+	sub.Ack("some-other-nonce", versionsOf(first), nil)
+
+	// The ack didn't apply, so the resource is still unacked and still
+	// reported as changed.
+	second := c.Diff(sub)
+	assert.True(t, second.HasDelta)
+	assert.Contains(t, second.Changed, "a")
+}
+
+func TestAckOfRemovalClearsItFromAckedStateSoItIsNotReportedAgain(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+	first := c.Diff(sub)
+	sub.MarkSent(first.Nonce)
+	sub.Ack(first.Nonce, versionsOf(first), first.Removed)
+
+	c.SetResources("key", "type", map[string]Resource{})
+	second := c.Diff(sub)
+	sub.MarkSent(second.Nonce)
+	sub.Ack(second.Nonce, versionsOf(second), second.Removed)
+
+	third := c.Diff(sub)
+	assert.False(t, third.HasDelta)
+	assert.Empty(t, third.Removed)
+}
+
+func TestNackLeavesSubscriptionUnackedSoTheResourceIsResent(t *testing.T) {
+	c := New()
+	c.SetResources("key", "type", map[string]Resource{
+		"a": {Name: "a", Version: "v1"},
+	})
+	sub := NewSubscription("key", "type", nil)
+	first := c.Diff(sub)
+	sub.MarkSent(first.Nonce)
+
+	sub.Nack(first.Nonce)
+
+	second := c.Diff(sub)
+	assert.True(t, second.HasDelta)
+	assert.Contains(t, second.Changed, "a")
+}
+
+// versionsOf builds the "sent" map Ack expects out of a Diff's Changed set,
+// mirroring what deltaLoop.recordSent does in internal/app/server/delta.go.
+func versionsOf(diff Diff) map[string]string {
+	sent := make(map[string]string, len(diff.Changed))
+	for name, r := range diff.Changed {
+		sent[name] = r.Version
+	}
+	return sent
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	anypb "github.com/golang/protobuf/ptypes/any"
+)
+
+// asAny recovers the Any payload a cache.Resource was stored with. v2 and
+// v3 Resource messages both carry their payload as *anypb.Any (go-control-
+// plane generates both versions off the same golang/protobuf Any type), so
+// one helper serves both StreamAggregatedResources/DeltaAggregatedResources
+// adapters. This only fails to assert if something other than an upstream
+// client populated the cache entry, which would itself be a bug upstream
+// of here.
+func asAny(body interface{}) *anypb.Any {
+	any, _ := body.(*anypb.Any)
+	return any
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"github.com/envoyproxy/xds-relay/internal/app/cache"
+)
+
+// deltaLoop drives one Delta xDS downstream stream: the shared
+// deltaWatchManager for its aggregation key merges whatever upstream sends
+// into the cache and wakes this loop up, which recomputes its stream's
+// per-resource diff against the cache on every trigger (an upstream push,
+// or the downstream changing its subscription / acking/nacking a previous
+// response), and pushes a response whenever that diff actually has
+// something to report. The one exception is the very first diff, which is
+// always sent even if empty, since an empty Delta response is how a
+// newly-subscribed resource set is reported "warmed up". Skipping empty
+// subsequent diffs matters because a plain ACK of a real update otherwise
+// triggers an empty response, which the downstream then ACKs too, and so on
+// forever.
+type deltaLoop struct {
+	aggCache *cache.Cache
+	sub      *cache.Subscription
+
+	// warmed is set once this stream's first response, sent or empty, has
+	// gone out. Every response after that is only sent if it has a delta.
+	warmed bool
+
+	// sent holds the version every resource was sent at in the response
+	// carrying the subscription's current pendingNonce, so a clean ACK for
+	// that nonce can be recorded against the versions the downstream is
+	// actually acking rather than whatever the cache holds by the time the
+	// ACK arrives.
+	sent map[string]string
+
+	// removed holds the resource names reported removed in the response
+	// carrying the subscription's current pendingNonce, so a clean ACK of
+	// that nonce can clear them out of the subscription's acked state --
+	// otherwise Diff would keep finding them "previously acked" and re-report
+	// the same removal forever.
+	removed []string
+}
+
+func newDeltaLoop(aggCache *cache.Cache, aggregationKey, typeURL string, initialResourceNames []string) *deltaLoop {
+	return &deltaLoop{
+		aggCache: aggCache,
+		sub:      cache.NewSubscription(aggregationKey, typeURL, initialResourceNames),
+	}
+}
+
+// recordSent remembers the versions and removals of a diff just sent so a
+// subsequent ACK of this diff's nonce can be applied to the subscription's
+// acked state.
+func (l *deltaLoop) recordSent(diff cache.Diff) {
+	sent := make(map[string]string, len(diff.Changed))
+	for name, r := range diff.Changed {
+		sent[name] = r.Version
+	}
+	l.sent = sent
+	l.removed = diff.Removed
+}
+
+// DeltaAggregatedResources implements the v2 Incremental ADS rpc.
+func (a *adsV2) DeltaAggregatedResources(
+	stream discoveryv2.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	nodeID := ""
+	if req.Node != nil {
+		nodeID = req.Node.Id
+	}
+	aggregationKey := a.aggregationKeyFor(nodeID, req.TypeUrl)
+	loop := newDeltaLoop(a.cache, aggregationKey, req.TypeUrl, req.ResourceNamesSubscribe)
+	sLogger := streamLogger(a.logger, nodeID, req.TypeUrl, nextStreamID())
+	sLogger.Info(ctx, "opened Delta v2 stream")
+
+	upstreamNotifyCh, shutdown, err := a.deltaWatchV2.Subscribe(aggregationKey, req.TypeUrl)
+	if err != nil {
+		sLogger.Error(ctx, "failed to open upstream delta stream: %s", err.Error())
+		return err
+	}
+	defer shutdown()
+
+	// Drain subsequent downstream requests (subscription changes and
+	// per-resource ACK/NACK) without blocking the upstream->downstream push
+	// loop below.
+	downstreamReqCh := make(chan *v2.DeltaDiscoveryRequest)
+	go func() {
+		defer close(downstreamReqCh)
+		for {
+			r, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			downstreamReqCh <- r
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case r, more := <-downstreamReqCh:
+			if !more {
+				return nil
+			}
+			if r.ErrorDetail != nil {
+				sLogger.With("nonce", r.ResponseNonce).Warn(ctx, "downstream nacked: %s", r.ErrorDetail.Message)
+				loop.sub.Nack(r.ResponseNonce)
+			} else {
+				loop.sub.Ack(r.ResponseNonce, loop.sent, loop.removed)
+				loop.sub.Update(r.ResourceNamesSubscribe, r.ResourceNamesUnsubscribe)
+			}
+
+		case _, more := <-upstreamNotifyCh:
+			if !more {
+				return nil
+			}
+		}
+
+		diff := a.cache.Diff(loop.sub)
+		if !diff.HasDelta && loop.warmed {
+			continue
+		}
+		loop.warmed = true
+		loop.recordSent(diff)
+		loop.sub.MarkSent(diff.Nonce)
+		sLogger.With("nonce", diff.Nonce).Debug(ctx, "relaying Delta v2 response")
+		if err := stream.Send(deltaResponseV2(req.TypeUrl, diff)); err != nil {
+			return err
+		}
+	}
+}
+
+// DeltaAggregatedResources implements the v3 Incremental ADS rpc.
+func (a *adsV3) DeltaAggregatedResources(
+	stream discoveryv3.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
+) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	nodeID := ""
+	if req.Node != nil {
+		nodeID = req.Node.Id
+	}
+	aggregationKey := a.aggregationKeyFor(nodeID, req.TypeUrl)
+	loop := newDeltaLoop(a.cache, aggregationKey, req.TypeUrl, req.ResourceNamesSubscribe)
+	sLogger := streamLogger(a.logger, nodeID, req.TypeUrl, nextStreamID())
+	sLogger.Info(ctx, "opened Delta v3 stream")
+
+	upstreamNotifyCh, shutdown, err := a.deltaWatchV3.Subscribe(aggregationKey, req.TypeUrl)
+	if err != nil {
+		sLogger.Error(ctx, "failed to open v3 upstream delta stream: %s", err.Error())
+		return err
+	}
+	defer shutdown()
+
+	downstreamReqCh := make(chan *discoveryv3.DeltaDiscoveryRequest)
+	go func() {
+		defer close(downstreamReqCh)
+		for {
+			r, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			downstreamReqCh <- r
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case r, more := <-downstreamReqCh:
+			if !more {
+				return nil
+			}
+			if r.ErrorDetail != nil {
+				sLogger.With("nonce", r.ResponseNonce).Warn(ctx, "downstream nacked: %s", r.ErrorDetail.Message)
+				loop.sub.Nack(r.ResponseNonce)
+			} else {
+				loop.sub.Ack(r.ResponseNonce, loop.sent, loop.removed)
+				loop.sub.Update(r.ResourceNamesSubscribe, r.ResourceNamesUnsubscribe)
+			}
+
+		case _, more := <-upstreamNotifyCh:
+			if !more {
+				return nil
+			}
+		}
+
+		diff := a.cache.Diff(loop.sub)
+		if !diff.HasDelta && loop.warmed {
+			continue
+		}
+		loop.warmed = true
+		loop.recordSent(diff)
+		loop.sub.MarkSent(diff.Nonce)
+		sLogger.With("nonce", diff.Nonce).Debug(ctx, "relaying Delta v3 response")
+		if err := stream.Send(deltaResponseV3(req.TypeUrl, diff)); err != nil {
+			return err
+		}
+	}
+}
+
+func mergeUpstreamDeltaV2(aggCache *cache.Cache, aggregationKey, typeURL string, resp *v2.DeltaDiscoveryResponse) {
+	resources := aggCache.GetResources(aggregationKey, typeURL)
+	for _, r := range resp.Resources {
+		resources[r.Name] = cache.Resource{Name: r.Name, Version: r.Version, Body: r.Resource}
+	}
+	for _, name := range resp.RemovedResources {
+		delete(resources, name)
+	}
+	aggCache.SetResources(aggregationKey, typeURL, resources)
+}
+
+func mergeUpstreamDeltaV3(
+	aggCache *cache.Cache,
+	aggregationKey, typeURL string,
+	resp *discoveryv3.DeltaDiscoveryResponse,
+) {
+	resources := aggCache.GetResources(aggregationKey, typeURL)
+	for _, r := range resp.Resources {
+		resources[r.Name] = cache.Resource{Name: r.Name, Version: r.Version, Body: r.Resource}
+	}
+	for _, name := range resp.RemovedResources {
+		delete(resources, name)
+	}
+	aggCache.SetResources(aggregationKey, typeURL, resources)
+}
+
+func deltaResponseV2(typeURL string, diff cache.Diff) *v2.DeltaDiscoveryResponse {
+	resp := &v2.DeltaDiscoveryResponse{
+		TypeUrl:          typeURL,
+		Nonce:            diff.Nonce,
+		RemovedResources: diff.Removed,
+	}
+	for _, r := range diff.Changed {
+		resp.Resources = append(resp.Resources, &v2.Resource{
+			Name:     r.Name,
+			Version:  r.Version,
+			Resource: asAny(r.Body),
+		})
+	}
+	return resp
+}
+
+func deltaResponseV3(typeURL string, diff cache.Diff) *discoveryv3.DeltaDiscoveryResponse {
+	resp := &discoveryv3.DeltaDiscoveryResponse{
+		TypeUrl:          typeURL,
+		Nonce:            diff.Nonce,
+		RemovedResources: diff.Removed,
+	}
+	for _, r := range diff.Changed {
+		resp.Resources = append(resp.Resources, &discoveryv3.Resource{
+			Name:     r.Name,
+			Version:  r.Version,
+			Resource: asAny(r.Body),
+		})
+	}
+	return resp
+}
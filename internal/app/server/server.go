@@ -0,0 +1,232 @@
+// Package server wires together the upstream client and aggregation cache
+// into the downstream-facing gRPC ADS server that Envoys connect to.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+
+	"github.com/envoyproxy/xds-relay/internal/app/admin"
+	"github.com/envoyproxy/xds-relay/internal/app/cache"
+	"github.com/envoyproxy/xds-relay/internal/app/upstream"
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+	"github.com/envoyproxy/xds-relay/internal/pkg/service"
+	aggregationv1 "github.com/envoyproxy/xds-relay/pkg/api/aggregation/v1"
+	bootstrapv1 "github.com/envoyproxy/xds-relay/pkg/api/bootstrap/v1"
+)
+
+// Server is the downstream-facing xDS server state shared by the v2 and
+// v3 AggregatedDiscoveryService adapters (adsV2/adsV3 in sotw.go/delta.go).
+// A given downstream stream only ever speaks one of SotW or Delta -- that's
+// an invariant of which rpc the client calls, not something the server
+// needs to enforce -- but both can be in flight concurrently across
+// different streams on the same listener.
+type Server struct {
+	cache     *cache.Cache
+	upstream  upstream.Client
+	upstream3 upstream.ClientV3
+	keyer     *aggregationv1.KeyerConfiguration
+	logger    log.Logger
+
+	// sotwWatch/deltaWatch multiplex every downstream stream resolving to
+	// the same (aggregation key, type URL) onto a single upstream watch --
+	// see watch.go. upstream/upstream3 above are still used directly to
+	// dial those shared watches' first subscriber.
+	sotwWatchV2  *sotwWatchManagerV2
+	sotwWatchV3  *sotwWatchManagerV3
+	deltaWatchV2 *deltaWatchManagerV2
+	deltaWatchV3 *deltaWatchManagerV3
+}
+
+// New creates a Server backed by the given aggregation cache, upstream
+// clients, and keyer configuration. keyer may be nil, in which case every
+// node falls back to its own cache entry (see aggregationKeyFor).
+func New(
+	c *cache.Cache,
+	upstreamClient upstream.Client,
+	upstreamClientV3 upstream.ClientV3,
+	keyer *aggregationv1.KeyerConfiguration,
+	logger log.Logger,
+) *Server {
+	return &Server{
+		cache:        c,
+		upstream:     upstreamClient,
+		upstream3:    upstreamClientV3,
+		keyer:        keyer,
+		logger:       logger,
+		sotwWatchV2:  newSotwWatchManagerV2(upstreamClient.OpenStream),
+		sotwWatchV3:  newSotwWatchManagerV3(upstreamClientV3.OpenStream),
+		deltaWatchV2: newDeltaWatchManagerV2(c, upstreamClient.OpenDeltaStream),
+		deltaWatchV3: newDeltaWatchManagerV3(c, upstreamClientV3.OpenDeltaStream),
+	}
+}
+
+// Relay is the top-level composition of every long-running piece of an
+// xds-relay instance: the downstream gRPC server, the upstream client's
+// health monitor, and the admin HTTP endpoint. It implements
+// service.Service by fanning Serve out to each of them and returning the
+// first non-nil error, canceling the others.
+type Relay struct {
+	grpcServer *grpc.Server
+	listenAddr string
+
+	upstreamClient   upstream.Client
+	upstreamClientV3 upstream.ClientV3
+	admin            *admin.Server
+
+	logger log.Logger
+	ready  chan struct{}
+}
+
+var _ service.Service = (*Relay)(nil)
+
+// New builds a Relay from bootstrap and aggregation rules configuration.
+// It dials the upstream endpoints and binds nothing yet -- listening
+// happens in Serve -- so a New that returns without error means
+// configuration was valid and upstream connections were established, not
+// that the relay is reachable yet.
+func NewRelay(
+	bootstrap *bootstrapv1.Bootstrap,
+	keyerConfiguration *aggregationv1.KeyerConfiguration,
+	logLevel string,
+) (*Relay, error) {
+	level, format := logLevel, "json"
+	if bootstrap.Logging != nil {
+		if bootstrap.Logging.Level != "" {
+			level = bootstrap.Logging.Level
+		}
+		if bootstrap.Logging.Format != "" {
+			format = bootstrap.Logging.Format
+		}
+	}
+	logger, err := log.New(level, format)
+	if err != nil {
+		return nil, fmt.Errorf("initializing logger: %w", err)
+	}
+
+	if bootstrap.OriginServer == nil || len(bootstrap.OriginServer.Cluster) == 0 ||
+		len(bootstrap.OriginServer.Cluster[0].Endpoints) == 0 {
+		return nil, fmt.Errorf("bootstrap config has no origin server endpoints configured")
+	}
+	originEndpoints := make([]string, 0, len(bootstrap.OriginServer.Cluster[0].Endpoints))
+	for _, ep := range bootstrap.OriginServer.Cluster[0].Endpoints {
+		originEndpoints = append(originEndpoints, fmt.Sprintf("%s:%d", ep.Address, ep.Port))
+	}
+
+	// The upstream clients dial synchronously in upstream.New/NewV3, so
+	// background(), used below for the relay-wide context, just needs to
+	// outlive this constructor; Serve takes the ctx that actually bounds
+	// stream lifetime.
+	upstreamClient, err := upstream.New(context.Background(), originEndpoints, upstream.CallOptions{}, logger.Named("upstream"))
+	if err != nil {
+		return nil, fmt.Errorf("creating upstream client: %w", err)
+	}
+	upstreamClientV3, err := upstream.NewV3(
+		context.Background(), originEndpoints, upstream.CallOptions{}, logger.Named("upstream.v3"))
+	if err != nil {
+		return nil, fmt.Errorf("creating v3 upstream client: %w", err)
+	}
+
+	aggregationCache := cache.New()
+	relayServer := New(aggregationCache, upstreamClient, upstreamClientV3, keyerConfiguration, logger.Named("server"))
+
+	grpcServer := grpc.NewServer()
+	discoveryv2.RegisterAggregatedDiscoveryServiceServer(grpcServer, &adsV2{relayServer})
+	discoveryv3.RegisterAggregatedDiscoveryServiceServer(grpcServer, &adsV3{relayServer})
+
+	address := "0.0.0.0"
+	port := uint32(9991)
+	if bootstrap.Server != nil {
+		if bootstrap.Server.Address != "" {
+			address = bootstrap.Server.Address
+		}
+		if bootstrap.Server.Port != 0 {
+			port = bootstrap.Server.Port
+		}
+	}
+
+	return &Relay{
+		grpcServer:       grpcServer,
+		listenAddr:       fmt.Sprintf("%s:%d", address, port),
+		upstreamClient:   upstreamClient,
+		upstreamClientV3: upstreamClientV3,
+		admin:            admin.New(adminAddr(bootstrap), logger.Named("admin")),
+		logger:           logger,
+		ready:            make(chan struct{}),
+	}, nil
+}
+
+func adminAddr(bootstrap *bootstrapv1.Bootstrap) string {
+	// The admin endpoint always binds one port above the xDS listener port,
+	// since bootstrap configuration doesn't have a dedicated field for it
+	// yet.
+	port := uint32(9991)
+	if bootstrap.Server != nil && bootstrap.Server.Port != 0 {
+		port = bootstrap.Server.Port
+	}
+	return fmt.Sprintf("0.0.0.0:%d", port+1)
+}
+
+// Ready is closed once the xDS gRPC listener is bound and serving.
+func (r *Relay) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// Serve runs every sub-service until ctx is canceled or one of them fails,
+// then tears down the rest and returns the first error.
+func (r *Relay) Serve(ctx context.Context) error {
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error { return r.serveGRPC(gctx) })
+	g.Go(func() error { return r.upstreamClient.Background().Serve(gctx) })
+	g.Go(func() error { return r.upstreamClientV3.Background().Serve(gctx) })
+	g.Go(func() error { return r.admin.Serve(gctx) })
+
+	return g.Wait()
+}
+
+func (r *Relay) serveGRPC(ctx context.Context) error {
+	listener, err := net.Listen("tcp", r.listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", r.listenAddr, err)
+	}
+	close(r.ready)
+
+	go func() {
+		<-ctx.Done()
+		r.grpcServer.GracefulStop()
+	}()
+
+	r.logger.Info(ctx, "serving xds-relay on %s", r.listenAddr)
+	return r.grpcServer.Serve(listener)
+}
+
+// RunWithContext is the CLI entry point: it builds a Relay and serves it
+// until ctx is canceled, then invokes cancel itself so callers running
+// this in a goroutine can still select on ctx.Done() to learn it's
+// finished. It returns the terminal error (nil on a clean, context-caused
+// shutdown) instead of swallowing it, so operators get a real exit code on
+// port-in-use / TLS / config-load failures instead of a goroutine dying
+// silently.
+func RunWithContext(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	bootstrap *bootstrapv1.Bootstrap,
+	keyerConfiguration *aggregationv1.KeyerConfiguration,
+	logLevel string,
+	mode string,
+) error {
+	defer cancel()
+
+	relay, err := NewRelay(bootstrap, keyerConfiguration, logLevel)
+	if err != nil {
+		return err
+	}
+	return relay.Serve(ctx)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// adsV2 and adsV3 adapt Server to the v2 and v3 AggregatedDiscoveryService
+// interfaces respectively. They're separate types, rather than methods
+// directly on Server, because both interfaces declare a method named
+// StreamAggregatedResources (and DeltaAggregatedResources) with
+// version-specific stream types -- Go doesn't allow overloading a single
+// method set on those names, so each version gets its own thin adapter
+// sharing the same underlying Server.
+type adsV2 struct{ *Server }
+type adsV3 struct{ *Server }
+
+// aggregationKeyFor computes the cache key a request's node/type URL maps
+// to, by evaluating the Server's configured keyer rules
+// (pkg/api/aggregation/v1). Nodes whose requests match the same rule
+// share a cache entry and thus a single upstream watch; nodes that match
+// no rule -- or when no keyer configuration was supplied at all -- fall
+// back to their own node ID, which is always correct albeit not
+// space-efficient.
+func (a *Server) aggregationKeyFor(nodeID, typeURL string) string {
+	return a.keyer.Resolve(typeURL, nodeID)
+}
+
+// streamLogger returns a,logger with node_id, type_url and stream_id
+// attached as first-class fields, so every line emitted over the lifetime
+// of one downstream stream can be filtered to just that stream without
+// grepping message text.
+func streamLogger(base log.Logger, nodeID, typeURL string, streamID int64) log.Logger {
+	return base.With("node_id", nodeID).With("type_url", typeURL).With("stream_id", streamID)
+}
+
+// StreamAggregatedResources implements the v2 State-of-the-World ADS rpc.
+func (a *adsV2) StreamAggregatedResources(
+	stream discoveryv2.AggregatedDiscoveryService_StreamAggregatedResourcesServer,
+) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	nodeID := ""
+	if req.Node != nil {
+		nodeID = req.Node.Id
+	}
+	aggregationKey := a.aggregationKeyFor(nodeID, req.TypeUrl)
+	sLogger := streamLogger(a.logger, nodeID, req.TypeUrl, nextStreamID())
+	sLogger.Info(ctx, "opened SotW v2 stream")
+
+	upstreamRespCh, shutdown, err := a.sotwWatchV2.Subscribe(watchKey(aggregationKey, req.TypeUrl), req)
+	if err != nil {
+		sLogger.Error(ctx, "failed to open upstream stream: %s", err.Error())
+		return err
+	}
+	defer shutdown()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp, more := <-upstreamRespCh:
+			if !more {
+				return nil
+			}
+			sLogger.With("version_info", resp.VersionInfo).With("nonce", resp.Nonce).
+				Debug(ctx, "relaying SotW v2 response")
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamAggregatedResources implements the v3 State-of-the-World ADS rpc.
+func (a *adsV3) StreamAggregatedResources(
+	stream discoveryv3.AggregatedDiscoveryService_StreamAggregatedResourcesServer,
+) error {
+	ctx := stream.Context()
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	nodeID := ""
+	if req.Node != nil {
+		nodeID = req.Node.Id
+	}
+	aggregationKey := a.aggregationKeyFor(nodeID, req.TypeUrl)
+	sLogger := streamLogger(a.logger, nodeID, req.TypeUrl, nextStreamID())
+	sLogger.Info(ctx, "opened SotW v3 stream")
+
+	upstreamRespCh, shutdown, err := a.sotwWatchV3.Subscribe(watchKey(aggregationKey, req.TypeUrl), req)
+	if err != nil {
+		sLogger.Error(ctx, "failed to open v3 upstream stream: %s", err.Error())
+		return err
+	}
+	defer shutdown()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp, more := <-upstreamRespCh:
+			if !more {
+				return nil
+			}
+			sLogger.With("version_info", resp.VersionInfo).With("nonce", resp.Nonce).
+				Debug(ctx, "relaying SotW v3 response")
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package server
+
+import "sync/atomic"
+
+var streamIDCounter int64
+
+// nextStreamID returns a process-unique id for a newly opened downstream
+// stream, so log lines from concurrent streams can be told apart without
+// relying on node_id alone (a single node can open more than one stream,
+// e.g. one per type URL).
+func nextStreamID() int64 {
+	return atomic.AddInt64(&streamIDCounter, 1)
+}
@@ -0,0 +1,458 @@
+package server
+
+import (
+	"sync"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"github.com/envoyproxy/xds-relay/internal/app/cache"
+)
+
+// This file gives aggregationKeyFor's doc comment ("nodes whose requests
+// match the same rule share ... a single upstream watch") somewhere to
+// actually happen. Without it, sotw.go and delta.go each called
+// upstream.OpenStream/OpenDeltaStream once per downstream stream, so N
+// Envoys resolving to the same aggregation key still opened N independent
+// upstream watches -- the cache fanned out what little state it held, but
+// the origin server still saw N subscribers, not one. The four watch
+// managers below -- SotW v2/v3 and Delta v2/v3 -- own exactly one upstream
+// watch per (aggregation key, type URL), dialed on the first subscriber and
+// torn down once the last one leaves, with every downstream stream riding
+// the same upstream connection in between.
+
+// watchKey identifies a shared upstream watch by aggregation key and type
+// URL, mirroring how the cache itself keys entries (cache.entryKey).
+func watchKey(aggregationKey, typeURL string) string {
+	return aggregationKey + "/" + typeURL
+}
+
+// sotwWatchV2 is the single upstream SotW v2 stream shared by every
+// downstream stream resolving to the same aggregation key and type URL.
+type sotwWatchV2 struct {
+	subscribers map[int64]chan *v2.DiscoveryResponse
+	nextID      int64
+	shutdown    func()
+	last        *v2.DiscoveryResponse
+}
+
+// sotwWatchManagerV2 owns the set of currently-open sotwWatchV2 watches,
+// keyed by "<aggregationKey>/<typeURL>".
+type sotwWatchManagerV2 struct {
+	open func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error)
+
+	mu      sync.Mutex
+	watches map[string]*sotwWatchV2
+}
+
+func newSotwWatchManagerV2(
+	open func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error),
+) *sotwWatchManagerV2 {
+	return &sotwWatchManagerV2{open: open, watches: make(map[string]*sotwWatchV2)}
+}
+
+// Subscribe joins the shared upstream watch for key, dialing upstream with
+// req if this is the first subscriber for that key. It returns a channel
+// fed with every response the shared upstream stream produces -- seeded
+// with the most recently observed one, if any, so a late joiner doesn't sit
+// idle until upstream pushes again -- and an unsubscribe func the caller
+// must invoke exactly once; the upstream watch itself is closed once the
+// last subscriber leaves.
+func (m *sotwWatchManagerV2) Subscribe(
+	key string,
+	req *v2.DiscoveryRequest,
+) (<-chan *v2.DiscoveryResponse, func(), error) {
+	m.mu.Lock()
+	w, ok := m.watches[key]
+	if !ok {
+		upstreamCh, shutdown, err := m.open(req)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, nil, err
+		}
+		w = &sotwWatchV2{subscribers: make(map[int64]chan *v2.DiscoveryResponse), shutdown: shutdown}
+		m.watches[key] = w
+		go m.pump(key, w, upstreamCh)
+	}
+
+	id := w.nextID
+	w.nextID++
+	subCh := make(chan *v2.DiscoveryResponse, 1)
+	w.subscribers[id] = subCh
+	if w.last != nil {
+		subCh <- w.last
+	}
+	m.mu.Unlock()
+
+	return subCh, m.unsubscribeFunc(key, w, id), nil
+}
+
+func (m *sotwWatchManagerV2) unsubscribeFunc(key string, w *sotwWatchV2, id int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if sub, ok := w.subscribers[id]; ok {
+				delete(w.subscribers, id)
+				close(sub)
+			}
+			if len(w.subscribers) == 0 && m.watches[key] == w {
+				delete(m.watches, key)
+				w.shutdown()
+			}
+		})
+	}
+}
+
+// pump relays every response the shared upstream stream produces to every
+// current subscriber, replacing a subscriber's buffered response rather
+// than blocking on a slow reader -- a SotW response is a full snapshot, so
+// only the latest one is ever worth delivering.
+func (m *sotwWatchManagerV2) pump(key string, w *sotwWatchV2, upstreamCh <-chan *v2.DiscoveryResponse) {
+	for resp := range upstreamCh {
+		m.mu.Lock()
+		w.last = resp
+		for _, sub := range w.subscribers {
+			replaceLatestV2(sub, resp)
+		}
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range w.subscribers {
+		close(sub)
+	}
+	if m.watches[key] == w {
+		delete(m.watches, key)
+	}
+}
+
+// sotwWatchV3 is the v3 counterpart of sotwWatchV2.
+type sotwWatchV3 struct {
+	subscribers map[int64]chan *discoveryv3.DiscoveryResponse
+	nextID      int64
+	shutdown    func()
+	last        *discoveryv3.DiscoveryResponse
+}
+
+// sotwWatchManagerV3 is the v3 counterpart of sotwWatchManagerV2.
+type sotwWatchManagerV3 struct {
+	open func(*discoveryv3.DiscoveryRequest) (<-chan *discoveryv3.DiscoveryResponse, func(), error)
+
+	mu      sync.Mutex
+	watches map[string]*sotwWatchV3
+}
+
+func newSotwWatchManagerV3(
+	open func(*discoveryv3.DiscoveryRequest) (<-chan *discoveryv3.DiscoveryResponse, func(), error),
+) *sotwWatchManagerV3 {
+	return &sotwWatchManagerV3{open: open, watches: make(map[string]*sotwWatchV3)}
+}
+
+// Subscribe is the v3 counterpart of sotwWatchManagerV2.Subscribe.
+func (m *sotwWatchManagerV3) Subscribe(
+	key string,
+	req *discoveryv3.DiscoveryRequest,
+) (<-chan *discoveryv3.DiscoveryResponse, func(), error) {
+	m.mu.Lock()
+	w, ok := m.watches[key]
+	if !ok {
+		upstreamCh, shutdown, err := m.open(req)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, nil, err
+		}
+		w = &sotwWatchV3{subscribers: make(map[int64]chan *discoveryv3.DiscoveryResponse), shutdown: shutdown}
+		m.watches[key] = w
+		go m.pump(key, w, upstreamCh)
+	}
+
+	id := w.nextID
+	w.nextID++
+	subCh := make(chan *discoveryv3.DiscoveryResponse, 1)
+	w.subscribers[id] = subCh
+	if w.last != nil {
+		subCh <- w.last
+	}
+	m.mu.Unlock()
+
+	return subCh, m.unsubscribeFunc(key, w, id), nil
+}
+
+func (m *sotwWatchManagerV3) unsubscribeFunc(key string, w *sotwWatchV3, id int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if sub, ok := w.subscribers[id]; ok {
+				delete(w.subscribers, id)
+				close(sub)
+			}
+			if len(w.subscribers) == 0 && m.watches[key] == w {
+				delete(m.watches, key)
+				w.shutdown()
+			}
+		})
+	}
+}
+
+func (m *sotwWatchManagerV3) pump(key string, w *sotwWatchV3, upstreamCh <-chan *discoveryv3.DiscoveryResponse) {
+	for resp := range upstreamCh {
+		m.mu.Lock()
+		w.last = resp
+		for _, sub := range w.subscribers {
+			replaceLatestV3(sub, resp)
+		}
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range w.subscribers {
+		close(sub)
+	}
+	if m.watches[key] == w {
+		delete(m.watches, key)
+	}
+}
+
+// replaceLatestV2 delivers resp to sub, a buffered channel of capacity 1,
+// dropping whatever was previously pending rather than blocking: only the
+// most recent SotW snapshot is ever worth a slow reader's time.
+func replaceLatestV2(sub chan *v2.DiscoveryResponse, resp *v2.DiscoveryResponse) {
+	select {
+	case sub <- resp:
+		return
+	default:
+	}
+	select {
+	case <-sub:
+	default:
+	}
+	sub <- resp
+}
+
+// replaceLatestV3 is the v3 counterpart of replaceLatestV2.
+func replaceLatestV3(sub chan *discoveryv3.DiscoveryResponse, resp *discoveryv3.DiscoveryResponse) {
+	select {
+	case sub <- resp:
+		return
+	default:
+	}
+	select {
+	case <-sub:
+	default:
+	}
+	sub <- resp
+}
+
+// deltaWatchV2 is the single upstream Delta v2 stream shared by every
+// downstream Delta stream resolving to the same aggregation key and type
+// URL. Unlike SotW, the upstream payload is merged straight into the
+// aggregation cache (mergeUpstreamDeltaV2) rather than fanned out verbatim:
+// each downstream's own cache.Subscription already tracks its own resource
+// subset and ack state against that shared cache, so all the watch needs to
+// do beyond keeping the cache warm is nudge every subscriber to recompute
+// its diff whenever upstream pushes something new. The shared watch always
+// subscribes wildcard upstream -- every resource of the type -- independent
+// of what any individual downstream asked for, since the cache has to hold
+// the full set for per-subscriber diffing to work no matter what any one
+// downstream is subscribed to.
+type deltaWatchV2 struct {
+	subscribers map[int64]chan struct{}
+	nextID      int64
+	shutdown    func()
+}
+
+// deltaWatchManagerV2 owns the set of currently-open deltaWatchV2 watches,
+// keyed by "<aggregationKey>/<typeURL>".
+type deltaWatchManagerV2 struct {
+	aggCache *cache.Cache
+	open     func(*v2.DeltaDiscoveryRequest) (<-chan *v2.DeltaDiscoveryResponse, func(), error)
+
+	mu      sync.Mutex
+	watches map[string]*deltaWatchV2
+}
+
+func newDeltaWatchManagerV2(
+	aggCache *cache.Cache,
+	open func(*v2.DeltaDiscoveryRequest) (<-chan *v2.DeltaDiscoveryResponse, func(), error),
+) *deltaWatchManagerV2 {
+	return &deltaWatchManagerV2{aggCache: aggCache, open: open, watches: make(map[string]*deltaWatchV2)}
+}
+
+// Subscribe joins the shared upstream watch for (aggregationKey, typeURL),
+// wildcard-subscribing upstream if this is the first subscriber. It returns
+// a channel that receives a value every time the shared watch merges a
+// fresh upstream push into the cache -- the caller's cue to recompute its
+// own cache.Diff -- and an unsubscribe func the caller must invoke exactly
+// once; the upstream watch itself is closed once the last subscriber
+// leaves.
+func (m *deltaWatchManagerV2) Subscribe(aggregationKey, typeURL string) (<-chan struct{}, func(), error) {
+	key := watchKey(aggregationKey, typeURL)
+	m.mu.Lock()
+	w, ok := m.watches[key]
+	if !ok {
+		upstreamCh, shutdown, err := m.open(&v2.DeltaDiscoveryRequest{TypeUrl: typeURL})
+		if err != nil {
+			m.mu.Unlock()
+			return nil, nil, err
+		}
+		w = &deltaWatchV2{subscribers: make(map[int64]chan struct{}), shutdown: shutdown}
+		m.watches[key] = w
+		go m.pump(key, aggregationKey, typeURL, w, upstreamCh)
+	}
+
+	id := w.nextID
+	w.nextID++
+	notifyCh := make(chan struct{}, 1)
+	w.subscribers[id] = notifyCh
+	m.mu.Unlock()
+
+	return notifyCh, m.unsubscribeFunc(key, w, id), nil
+}
+
+func (m *deltaWatchManagerV2) unsubscribeFunc(key string, w *deltaWatchV2, id int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if sub, ok := w.subscribers[id]; ok {
+				delete(w.subscribers, id)
+				close(sub)
+			}
+			if len(w.subscribers) == 0 && m.watches[key] == w {
+				delete(m.watches, key)
+				w.shutdown()
+			}
+		})
+	}
+}
+
+func (m *deltaWatchManagerV2) pump(
+	key, aggregationKey, typeURL string,
+	w *deltaWatchV2,
+	upstreamCh <-chan *v2.DeltaDiscoveryResponse,
+) {
+	for resp := range upstreamCh {
+		mergeUpstreamDeltaV2(m.aggCache, aggregationKey, typeURL, resp)
+		m.mu.Lock()
+		for _, sub := range w.subscribers {
+			notify(sub)
+		}
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range w.subscribers {
+		close(sub)
+	}
+	if m.watches[key] == w {
+		delete(m.watches, key)
+	}
+}
+
+// notify delivers a wakeup on a buffered capacity-1 channel without
+// blocking: a pending, un-consumed wakeup already means "recompute", so a
+// second one before the reader gets to it carries no new information.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// deltaWatchV3 is the v3 counterpart of deltaWatchV2.
+type deltaWatchV3 struct {
+	subscribers map[int64]chan struct{}
+	nextID      int64
+	shutdown    func()
+}
+
+// deltaWatchManagerV3 is the v3 counterpart of deltaWatchManagerV2.
+type deltaWatchManagerV3 struct {
+	aggCache *cache.Cache
+	open     func(*discoveryv3.DeltaDiscoveryRequest) (<-chan *discoveryv3.DeltaDiscoveryResponse, func(), error)
+
+	mu      sync.Mutex
+	watches map[string]*deltaWatchV3
+}
+
+func newDeltaWatchManagerV3(
+	aggCache *cache.Cache,
+	open func(*discoveryv3.DeltaDiscoveryRequest) (<-chan *discoveryv3.DeltaDiscoveryResponse, func(), error),
+) *deltaWatchManagerV3 {
+	return &deltaWatchManagerV3{aggCache: aggCache, open: open, watches: make(map[string]*deltaWatchV3)}
+}
+
+// Subscribe is the v3 counterpart of deltaWatchManagerV2.Subscribe.
+func (m *deltaWatchManagerV3) Subscribe(aggregationKey, typeURL string) (<-chan struct{}, func(), error) {
+	key := watchKey(aggregationKey, typeURL)
+	m.mu.Lock()
+	w, ok := m.watches[key]
+	if !ok {
+		upstreamCh, shutdown, err := m.open(&discoveryv3.DeltaDiscoveryRequest{TypeUrl: typeURL})
+		if err != nil {
+			m.mu.Unlock()
+			return nil, nil, err
+		}
+		w = &deltaWatchV3{subscribers: make(map[int64]chan struct{}), shutdown: shutdown}
+		m.watches[key] = w
+		go m.pump(key, aggregationKey, typeURL, w, upstreamCh)
+	}
+
+	id := w.nextID
+	w.nextID++
+	notifyCh := make(chan struct{}, 1)
+	w.subscribers[id] = notifyCh
+	m.mu.Unlock()
+
+	return notifyCh, m.unsubscribeFunc(key, w, id), nil
+}
+
+func (m *deltaWatchManagerV3) unsubscribeFunc(key string, w *deltaWatchV3, id int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if sub, ok := w.subscribers[id]; ok {
+				delete(w.subscribers, id)
+				close(sub)
+			}
+			if len(w.subscribers) == 0 && m.watches[key] == w {
+				delete(m.watches, key)
+				w.shutdown()
+			}
+		})
+	}
+}
+
+func (m *deltaWatchManagerV3) pump(
+	key, aggregationKey, typeURL string,
+	w *deltaWatchV3,
+	upstreamCh <-chan *discoveryv3.DeltaDiscoveryResponse,
+) {
+	for resp := range upstreamCh {
+		mergeUpstreamDeltaV3(m.aggCache, aggregationKey, typeURL, resp)
+		m.mu.Lock()
+		for _, sub := range w.subscribers {
+			notify(sub)
+		}
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range w.subscribers {
+		close(sub)
+	}
+	if m.watches[key] == w {
+		delete(m.watches, key)
+	}
+}
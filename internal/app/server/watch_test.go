@@ -0,0 +1,160 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/envoyproxy/xds-relay/internal/app/cache"
+)
+
+const testTimeout = time.Second
+
+func TestSotwWatchManagerSharesOneUpstreamWatchAcrossSubscribers(t *testing.T) {
+	upstreamCh := make(chan *v2.DiscoveryResponse, 1)
+	opens := 0
+	m := newSotwWatchManagerV2(func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+		opens++
+		return upstreamCh, func() {}, nil
+	})
+
+	sub1, unsub1, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	sub2, unsub2, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	defer unsub1()
+	defer unsub2()
+
+	assert.Equal(t, 1, opens, "a second subscriber for the same key must not dial upstream again")
+
+	resp := &v2.DiscoveryResponse{VersionInfo: "v1"}
+	upstreamCh <- resp
+
+	assertReceivesV2(t, sub1, resp)
+	assertReceivesV2(t, sub2, resp)
+}
+
+func TestSotwWatchManagerLateSubscriberGetsLastResponse(t *testing.T) {
+	upstreamCh := make(chan *v2.DiscoveryResponse, 1)
+	m := newSotwWatchManagerV2(func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+		return upstreamCh, func() {}, nil
+	})
+
+	sub1, unsub1, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	defer unsub1()
+
+	resp := &v2.DiscoveryResponse{VersionInfo: "v1"}
+	upstreamCh <- resp
+	assertReceivesV2(t, sub1, resp)
+
+	sub2, unsub2, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	defer unsub2()
+
+	assertReceivesV2(t, sub2, resp)
+}
+
+func TestSotwWatchManagerTearsDownUpstreamWatchOnceLastSubscriberLeaves(t *testing.T) {
+	upstreamCh := make(chan *v2.DiscoveryResponse, 1)
+	shutdownCalls := 0
+	m := newSotwWatchManagerV2(func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+		return upstreamCh, func() { shutdownCalls++ }, nil
+	})
+
+	_, unsub1, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	_, unsub2, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+
+	unsub1()
+	assert.Equal(t, 0, shutdownCalls, "the upstream watch must stay up while any subscriber remains")
+
+	unsub2()
+	assert.Equal(t, 1, shutdownCalls, "the upstream watch must be torn down once the last subscriber leaves")
+
+	// A subsequent Subscribe for the same key dials upstream again rather
+	// than reusing the torn-down watch.
+	opensAfter := 0
+	m.open = func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+		opensAfter++
+		return make(chan *v2.DiscoveryResponse), func() {}, nil
+	}
+	_, unsub3, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+	defer unsub3()
+	assert.Equal(t, 1, opensAfter)
+}
+
+func TestSotwWatchManagerUnsubscribeIsIdempotent(t *testing.T) {
+	upstreamCh := make(chan *v2.DiscoveryResponse, 1)
+	shutdownCalls := 0
+	m := newSotwWatchManagerV2(func(*v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+		return upstreamCh, func() { shutdownCalls++ }, nil
+	})
+
+	_, unsub, err := m.Subscribe("key", &v2.DiscoveryRequest{})
+	require.NoError(t, err)
+
+	unsub()
+	unsub()
+	assert.Equal(t, 1, shutdownCalls)
+}
+
+func TestDeltaWatchManagerMergesUpstreamIntoCacheAndNotifiesSubscribers(t *testing.T) {
+	upstreamCh := make(chan *v2.DeltaDiscoveryResponse, 1)
+	aggCache := cache.New()
+	m := newDeltaWatchManagerV2(aggCache, func(*v2.DeltaDiscoveryRequest) (<-chan *v2.DeltaDiscoveryResponse, func(), error) {
+		return upstreamCh, func() {}, nil
+	})
+
+	notifyCh, unsub, err := m.Subscribe("key", "type")
+	require.NoError(t, err)
+	defer unsub()
+
+	upstreamCh <- &v2.DeltaDiscoveryResponse{
+		Resources: []*v2.Resource{{Name: "a", Version: "v1"}},
+	}
+
+	select {
+	case <-notifyCh:
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for notification of upstream push")
+	}
+
+	resources := aggCache.GetResources("key", "type")
+	require.Contains(t, resources, "a")
+	assert.Equal(t, "v1", resources["a"].Version)
+}
+
+func TestDeltaWatchManagerTearsDownUpstreamWatchOnceLastSubscriberLeaves(t *testing.T) {
+	upstreamCh := make(chan *v2.DeltaDiscoveryResponse, 1)
+	shutdownCalls := 0
+	m := newDeltaWatchManagerV2(cache.New(), func(*v2.DeltaDiscoveryRequest) (<-chan *v2.DeltaDiscoveryResponse, func(), error) {
+		return upstreamCh, func() { shutdownCalls++ }, nil
+	})
+
+	_, unsub1, err := m.Subscribe("key", "type")
+	require.NoError(t, err)
+	_, unsub2, err := m.Subscribe("key", "type")
+	require.NoError(t, err)
+
+	unsub1()
+	assert.Equal(t, 0, shutdownCalls)
+
+	unsub2()
+	assert.Equal(t, 1, shutdownCalls)
+}
+
+func assertReceivesV2(t *testing.T, ch <-chan *v2.DiscoveryResponse, want *v2.DiscoveryResponse) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		assert.Same(t, want, got)
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for response")
+	}
+}
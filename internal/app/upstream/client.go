@@ -0,0 +1,221 @@
+// Package upstream implements the gRPC client that xds-relay uses to
+// originate State-of-the-World and Incremental (Delta) xDS requests
+// against an upstream management server. It supports multiple upstream
+// endpoints: a health-tracking balancer steers new streams to a healthy
+// endpoint and transparently re-establishes existing streams elsewhere if
+// their endpoint starts failing.
+package upstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+	"github.com/envoyproxy/xds-relay/internal/pkg/service"
+)
+
+// CallOptions configures the behavior of a single upstream stream.
+type CallOptions struct {
+	// Timeout bounds how long a stream may remain open without receiving a
+	// response before it is considered dead.
+	Timeout time.Duration
+}
+
+// Client originates xDS streams against a set of upstream management
+// server endpoints, failing over between them as their health changes.
+type Client interface {
+	// OpenStream starts a State-of-the-World xDS stream seeded with the
+	// given request. It returns a channel of responses, a shutdown function
+	// that tears the stream down, and an error if no healthy endpoint was
+	// available to establish it. If the underlying connection drops, the
+	// stream is transparently re-established against another healthy
+	// endpoint and re-subscribed with the last version_info/response_nonce
+	// this stream observed, so the downstream consumer never sees a version
+	// regression.
+	OpenStream(request *v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error)
+
+	// OpenDeltaStream is the Incremental xDS counterpart of OpenStream.
+	OpenDeltaStream(request *v2.DeltaDiscoveryRequest) (<-chan *v2.DeltaDiscoveryResponse, func(), error)
+
+	// Endpoints reports the health and usage of every configured upstream
+	// endpoint, for operator visibility into failover behavior.
+	Endpoints() []EndpointStatus
+
+	// Background returns the Service that drives this Client's periodic
+	// endpoint health probing. Callers that want probing running (the
+	// relay's top-level composition does) add it to their own errgroup;
+	// OpenStream/OpenDeltaStream's own failover on stream errors works
+	// whether or not it's running.
+	Background() service.Service
+}
+
+type client struct {
+	ctx      context.Context
+	balancer *balancer
+	options  CallOptions
+	logger   log.Logger
+}
+
+// New creates a Client that balances across the given set of upstream
+// endpoints (each "host:port"). ctx bounds the lifetime of every stream
+// opened through the returned Client: canceling it closes all outstanding
+// response channels.
+func New(ctx context.Context, endpoints []string, options CallOptions, logger log.Logger) (Client, error) {
+	b, err := newBalancer(ctx, endpoints, probeV2, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		ctx:      ctx,
+		balancer: b,
+		options:  options,
+		logger:   logger,
+	}, nil
+}
+
+func (c *client) Endpoints() []EndpointStatus {
+	return c.balancer.statuses()
+}
+
+func (c *client) Background() service.Service {
+	return c.balancer
+}
+
+func (c *client) OpenStream(request *v2.DiscoveryRequest) (<-chan *v2.DiscoveryResponse, func(), error) {
+	streamCtx, cancel := context.WithCancel(c.ctx)
+
+	ep, err := c.balancer.next()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	respCh := make(chan *v2.DiscoveryResponse)
+	// Clone so the redial loop can freely rewrite VersionInfo/ResponseNonce
+	// on its own copy without mutating the caller's request.
+	req, _ := proto.Clone(request).(*v2.DiscoveryRequest)
+
+	stream, err := openStreamOn(streamCtx, ep, req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go c.pumpSotW(streamCtx, ep, stream, req, respCh)
+
+	return respCh, cancel, nil
+}
+
+func openStreamOn(
+	ctx context.Context,
+	ep *endpoint,
+	req *v2.DiscoveryRequest,
+) (discoveryv2.AggregatedDiscoveryService_StreamAggregatedResourcesClient, error) {
+	adsClient := discoveryv2.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := adsClient.StreamAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	ep.incActiveStreams(1)
+	return stream, nil
+}
+
+// pumpSotW relays responses from ep to respCh until streamCtx is canceled.
+// If the stream dies with a retryable error it re-dials another healthy
+// endpoint and resumes, seeding the new request with the version_info and
+// response_nonce of the last response this stream delivered.
+func (c *client) pumpSotW(
+	streamCtx context.Context,
+	ep *endpoint,
+	stream discoveryv2.AggregatedDiscoveryService_StreamAggregatedResourcesClient,
+	req *v2.DiscoveryRequest,
+	respCh chan<- *v2.DiscoveryResponse,
+) {
+	defer close(respCh)
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			if !isRetryableGRPCError(err) {
+				c.logger.Error(streamCtx, "upstream stream recv error: %s", err.Error())
+				return
+			}
+
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialSotW(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+
+		req.VersionInfo = resp.VersionInfo
+		req.ResponseNonce = resp.Nonce
+
+		select {
+		case respCh <- resp:
+		case <-streamCtx.Done():
+			ep.incActiveStreams(-1)
+			return
+		}
+
+		// The origin's watch for the version/nonce we just received is spent:
+		// it fires once and then waits for a new request before it will ever
+		// send again, the same way it would wait on a real Envoy to ACK
+		// before pushing the next update. Re-sending req here is that ACK,
+		// and re-arms the watch for the next push.
+		if err := stream.Send(req); err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed to re-arm watch, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialSotW(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+	}
+}
+
+func (c *client) redialSotW(
+	ctx context.Context,
+	req *v2.DiscoveryRequest,
+) (*endpoint, discoveryv2.AggregatedDiscoveryService_StreamAggregatedResourcesClient, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+		ep, err := c.balancer.next()
+		if err != nil {
+			c.logger.Error(ctx, "no healthy upstream endpoints available: %s", err.Error())
+			return nil, nil, false
+		}
+		stream, err := openStreamOn(ctx, ep, req)
+		if err != nil {
+			ep.markUnhealthy(err)
+			continue
+		}
+		return ep, stream, true
+	}
+}
@@ -0,0 +1,312 @@
+package upstream
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+	"github.com/envoyproxy/xds-relay/internal/pkg/service"
+)
+
+// ClientV3 is the v3 counterpart of Client. It is kept as a distinct
+// interface rather than a generic one because the v2 and v3 discovery
+// request/response types are unrelated Go types generated from different
+// proto packages. It offers the same multi-endpoint failover guarantees as
+// Client.
+type ClientV3 interface {
+	OpenStream(request *discoveryv3.DiscoveryRequest) (<-chan *discoveryv3.DiscoveryResponse, func(), error)
+	OpenDeltaStream(request *discoveryv3.DeltaDiscoveryRequest) (<-chan *discoveryv3.DeltaDiscoveryResponse, func(), error)
+
+	// Background returns the Service that drives this ClientV3's periodic
+	// endpoint health probing, mirroring Client.Background().
+	Background() service.Service
+}
+
+type clientV3 struct {
+	ctx      context.Context
+	balancer *balancer
+	options  CallOptions
+	logger   log.Logger
+}
+
+// NewV3 creates a ClientV3 that balances across the given set of upstream
+// endpoints (each "host:port"), mirroring New but speaking the v3 ADS
+// transport.
+func NewV3(ctx context.Context, endpoints []string, options CallOptions, logger log.Logger) (ClientV3, error) {
+	b, err := newBalancer(ctx, endpoints, probeV3, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientV3{
+		ctx:      ctx,
+		balancer: b,
+		options:  options,
+		logger:   logger,
+	}, nil
+}
+
+func (c *clientV3) Background() service.Service {
+	return c.balancer
+}
+
+func (c *clientV3) OpenStream(
+	request *discoveryv3.DiscoveryRequest,
+) (<-chan *discoveryv3.DiscoveryResponse, func(), error) {
+	streamCtx, cancel := context.WithCancel(c.ctx)
+
+	ep, err := c.balancer.next()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	respCh := make(chan *discoveryv3.DiscoveryResponse)
+	// Clone so the redial loop can freely rewrite VersionInfo/ResponseNonce
+	// on its own copy without mutating the caller's request.
+	req, _ := proto.Clone(request).(*discoveryv3.DiscoveryRequest)
+
+	stream, err := openStreamOnV3(streamCtx, ep, req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go c.pumpSotWV3(streamCtx, ep, stream, req, respCh)
+
+	return respCh, cancel, nil
+}
+
+func openStreamOnV3(
+	ctx context.Context,
+	ep *endpoint,
+	req *discoveryv3.DiscoveryRequest,
+) (discoveryv3.AggregatedDiscoveryService_StreamAggregatedResourcesClient, error) {
+	adsClient := discoveryv3.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := adsClient.StreamAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	ep.incActiveStreams(1)
+	return stream, nil
+}
+
+// pumpSotWV3 is the v3 counterpart of client.pumpSotW.
+func (c *clientV3) pumpSotWV3(
+	streamCtx context.Context,
+	ep *endpoint,
+	stream discoveryv3.AggregatedDiscoveryService_StreamAggregatedResourcesClient,
+	req *discoveryv3.DiscoveryRequest,
+	respCh chan<- *discoveryv3.DiscoveryResponse,
+) {
+	defer close(respCh)
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			if !isRetryableGRPCError(err) {
+				c.logger.Error(streamCtx, "upstream v3 stream recv error: %s", err.Error())
+				return
+			}
+
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialSotWV3(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+
+		req.VersionInfo = resp.VersionInfo
+		req.ResponseNonce = resp.Nonce
+
+		select {
+		case respCh <- resp:
+		case <-streamCtx.Done():
+			ep.incActiveStreams(-1)
+			return
+		}
+
+		// See client.pumpSotW: the origin's watch for the version/nonce we
+		// just received won't fire again until we send the next request, so
+		// this re-send is this stream's ACK, re-arming the watch.
+		if err := stream.Send(req); err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed to re-arm watch, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialSotWV3(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+	}
+}
+
+func (c *clientV3) redialSotWV3(
+	ctx context.Context,
+	req *discoveryv3.DiscoveryRequest,
+) (*endpoint, discoveryv3.AggregatedDiscoveryService_StreamAggregatedResourcesClient, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+		ep, err := c.balancer.next()
+		if err != nil {
+			c.logger.Error(ctx, "no healthy upstream endpoints available: %s", err.Error())
+			return nil, nil, false
+		}
+		stream, err := openStreamOnV3(ctx, ep, req)
+		if err != nil {
+			ep.markUnhealthy(err)
+			continue
+		}
+		return ep, stream, true
+	}
+}
+
+func (c *clientV3) OpenDeltaStream(
+	request *discoveryv3.DeltaDiscoveryRequest,
+) (<-chan *discoveryv3.DeltaDiscoveryResponse, func(), error) {
+	streamCtx, cancel := context.WithCancel(c.ctx)
+
+	ep, err := c.balancer.next()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	respCh := make(chan *discoveryv3.DeltaDiscoveryResponse)
+	// Clone so the redial loop can freely rewrite ResponseNonce on its own
+	// copy without mutating the caller's request.
+	req, _ := proto.Clone(request).(*discoveryv3.DeltaDiscoveryRequest)
+
+	stream, err := openDeltaStreamOnV3(streamCtx, ep, req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go c.pumpDeltaV3(streamCtx, ep, stream, req, respCh)
+
+	return respCh, cancel, nil
+}
+
+func openDeltaStreamOnV3(
+	ctx context.Context,
+	ep *endpoint,
+	req *discoveryv3.DeltaDiscoveryRequest,
+) (discoveryv3.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, error) {
+	adsClient := discoveryv3.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := adsClient.DeltaAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	ep.incActiveStreams(1)
+	return stream, nil
+}
+
+func (c *clientV3) pumpDeltaV3(
+	streamCtx context.Context,
+	ep *endpoint,
+	stream discoveryv3.AggregatedDiscoveryService_DeltaAggregatedResourcesClient,
+	req *discoveryv3.DeltaDiscoveryRequest,
+	respCh chan<- *discoveryv3.DeltaDiscoveryResponse,
+) {
+	defer close(respCh)
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			if !isRetryableGRPCError(err) {
+				c.logger.Error(streamCtx, "upstream v3 delta stream recv error: %s", err.Error())
+				return
+			}
+
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialDeltaV3(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+
+		req.ResponseNonce = resp.Nonce
+
+		select {
+		case respCh <- resp:
+		case <-streamCtx.Done():
+			ep.incActiveStreams(-1)
+			return
+		}
+
+		// See client.pumpSotW: the origin's watch for the nonce we just
+		// received won't fire again until we send the next request, so this
+		// re-send is this stream's ACK, re-arming the watch.
+		if err := stream.Send(req); err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed to re-arm watch, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialDeltaV3(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+	}
+}
+
+func (c *clientV3) redialDeltaV3(
+	ctx context.Context,
+	req *discoveryv3.DeltaDiscoveryRequest,
+) (*endpoint, discoveryv3.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+		ep, err := c.balancer.next()
+		if err != nil {
+			c.logger.Error(ctx, "no healthy upstream endpoints available: %s", err.Error())
+			return nil, nil, false
+		}
+		stream, err := openDeltaStreamOnV3(ctx, ep, req)
+		if err != nil {
+			ep.markUnhealthy(err)
+			continue
+		}
+		return ep, stream, true
+	}
+}
@@ -0,0 +1,146 @@
+package upstream
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+)
+
+// OpenDeltaStream starts an Incremental (Delta) xDS stream seeded with the
+// given request, balancing and failing over across endpoints the same way
+// OpenStream does. Unlike OpenStream, subsequent requests on this stream
+// may change the subscribed resource set (resource_names_subscribe /
+// resource_names_unsubscribe) and ack/nack individual resources via
+// response_nonce, so the stream loop below only ever forwards whatever the
+// caller last sent rather than trying to reconstruct subscription state
+// itself -- that bookkeeping lives in the aggregation cache.
+func (c *client) OpenDeltaStream(
+	request *v2.DeltaDiscoveryRequest,
+) (<-chan *v2.DeltaDiscoveryResponse, func(), error) {
+	streamCtx, cancel := context.WithCancel(c.ctx)
+
+	ep, err := c.balancer.next()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	respCh := make(chan *v2.DeltaDiscoveryResponse)
+	// Clone so the redial loop can freely rewrite ResponseNonce on its own
+	// copy without mutating the caller's request.
+	req, _ := proto.Clone(request).(*v2.DeltaDiscoveryRequest)
+
+	stream, err := openDeltaStreamOn(streamCtx, ep, req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go c.pumpDelta(streamCtx, ep, stream, req, respCh)
+
+	return respCh, cancel, nil
+}
+
+func openDeltaStreamOn(
+	ctx context.Context,
+	ep *endpoint,
+	req *v2.DeltaDiscoveryRequest,
+) (discoveryv2.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, error) {
+	adsClient := discoveryv2.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := adsClient.DeltaAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	ep.incActiveStreams(1)
+	return stream, nil
+}
+
+func (c *client) pumpDelta(
+	streamCtx context.Context,
+	ep *endpoint,
+	stream discoveryv2.AggregatedDiscoveryService_DeltaAggregatedResourcesClient,
+	req *v2.DeltaDiscoveryRequest,
+	respCh chan<- *v2.DeltaDiscoveryResponse,
+) {
+	defer close(respCh)
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			if !isRetryableGRPCError(err) {
+				c.logger.Error(streamCtx, "upstream delta stream recv error: %s", err.Error())
+				return
+			}
+
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialDelta(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+
+		req.ResponseNonce = resp.Nonce
+
+		select {
+		case respCh <- resp:
+		case <-streamCtx.Done():
+			ep.incActiveStreams(-1)
+			return
+		}
+
+		// See client.pumpSotW: the origin's watch for the nonce we just
+		// received won't fire again until we send the next request, so this
+		// re-send is this stream's ACK, re-arming the watch.
+		if err := stream.Send(req); err != nil {
+			ep.incActiveStreams(-1)
+			if streamCtx.Err() != nil {
+				return
+			}
+			c.logger.Warn(streamCtx, "upstream endpoint %s failed to re-arm watch, failing over: %s", ep.address, err.Error())
+			ep.markUnhealthy(err)
+
+			newEp, newStream, ok := c.redialDelta(streamCtx, req)
+			if !ok {
+				return
+			}
+			ep, stream = newEp, newStream
+			continue
+		}
+	}
+}
+
+func (c *client) redialDelta(
+	ctx context.Context,
+	req *v2.DeltaDiscoveryRequest,
+) (*endpoint, discoveryv2.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, false
+		}
+		ep, err := c.balancer.next()
+		if err != nil {
+			c.logger.Error(ctx, "no healthy upstream endpoints available: %s", err.Error())
+			return nil, nil, false
+		}
+		stream, err := openDeltaStreamOn(ctx, ep, req)
+		if err != nil {
+			ep.markUnhealthy(err)
+			continue
+		}
+		return ep, stream, true
+	}
+}
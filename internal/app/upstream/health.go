@@ -0,0 +1,333 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corev2 "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/envoyproxy/xds-relay/internal/pkg/log"
+)
+
+// healthCheckInterval is how often idle endpoints are probed for recovery.
+// Modeled after the etcd v3 client's health balancer, a probe is just a
+// throwaway request for a well-known type URL on a fresh stream -- if it
+// completes without a transport error the endpoint is marked healthy again.
+const healthCheckInterval = 5 * time.Second
+
+// dialTimeout bounds how long newBalancer blocks verifying each configured
+// endpoint is reachable before giving up on it.
+const dialTimeout = 5 * time.Second
+
+var errNoHealthyEndpoints = errors.New("upstream: no healthy endpoints available")
+
+// endpoint tracks the health and metrics of a single upstream address.
+type endpoint struct {
+	address string
+	conn    *grpc.ClientConn
+
+	mu            sync.Mutex
+	healthy       bool
+	dialAttempts  uint64
+	activeStreams int64
+	lastError     error
+}
+
+// EndpointStatus is a point-in-time snapshot of an endpoint's health and
+// usage, exposed to operators via Client.Endpoints().
+type EndpointStatus struct {
+	Address       string
+	Healthy       bool
+	DialAttempts  uint64
+	ActiveStreams int64
+	LastError     error
+}
+
+func (e *endpoint) status() EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return EndpointStatus{
+		Address:       e.address,
+		Healthy:       e.healthy,
+		DialAttempts:  e.dialAttempts,
+		ActiveStreams: e.activeStreams,
+		LastError:     e.lastError,
+	}
+}
+
+func (e *endpoint) markUnhealthy(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.healthy = false
+	e.lastError = err
+}
+
+func (e *endpoint) markHealthy() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.healthy = true
+}
+
+func (e *endpoint) incActiveStreams(delta int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.activeStreams += delta
+}
+
+// isRetryableGRPCError reports whether a stream error looks like a
+// transient endpoint failure (as opposed to, say, the caller canceling its
+// own context) and should trigger failover to another endpoint.
+func isRetryableGRPCError(err error) bool {
+	if err == nil {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// balancer round-robins OpenStream/OpenDeltaStream calls across healthy
+// upstream endpoints and keeps each endpoint's health up to date via
+// periodic probing and caller-reported stream errors. It implements
+// service.Service so its probe loop can be started and stopped as part of
+// the relay's overall lifecycle instead of being an unsupervised
+// goroutine: callers that want probing get it by running Client's
+// Background() service; callers that only care about OpenStream/
+// OpenDeltaStream's own failover (triggered by stream errors, not probing)
+// can ignore it entirely. The probe itself is injected since it needs to
+// speak whichever xDS wire version the owning Client originates.
+type balancer struct {
+	logger  log.Logger
+	healthz func(ctx context.Context, ep *endpoint)
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	cursor    int
+
+	ready chan struct{}
+}
+
+func newBalancer(
+	ctx context.Context,
+	addresses []string,
+	healthz func(ctx context.Context, ep *endpoint),
+	logger log.Logger,
+) (*balancer, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("upstream: at least one endpoint is required")
+	}
+
+	b := &balancer{logger: logger, healthz: healthz, ready: make(chan struct{})}
+	anyHealthy := false
+	for _, addr := range addresses {
+		ep, err := dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if ep.healthy {
+			anyHealthy = true
+		}
+		b.endpoints = append(b.endpoints, ep)
+	}
+	if !anyHealthy {
+		return nil, fmt.Errorf("upstream: none of %d configured endpoints are reachable", len(addresses))
+	}
+	close(b.ready)
+
+	return b, nil
+}
+
+// Ready is closed once every configured endpoint has been dialed.
+func (b *balancer) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Serve runs the periodic health probe loop until ctx is canceled, which is
+// probeLoop's only exit condition -- so this returns nil, not ctx.Err(), to
+// honor service.Service's contract that a clean, context-caused shutdown is
+// reported as success.
+func (b *balancer) Serve(ctx context.Context) error {
+	b.probeLoop(ctx)
+	return nil
+}
+
+// dial blocks until address is reachable or dialTimeout elapses. A
+// genuinely misconfigured target (e.g. unparseable address) fails dial
+// outright, but an address that's merely unreachable within dialTimeout is
+// not -- it comes back as an unhealthy endpoint with a live (lazily
+// connecting, auto-retrying) *grpc.ClientConn, so probeLoop can bring it
+// into rotation once the origin recovers instead of that one endpoint
+// permanently failing newBalancer (and in turn upstream.New/NewV3, and the
+// whole relay) over in what may be an otherwise-healthy multi-endpoint
+// configuration.
+func dial(ctx context.Context, address string) (*endpoint, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(dialCtx, address, grpc.WithInsecure(), grpc.WithBlock())
+	if err == nil {
+		return &endpoint{address: address, conn: conn, healthy: true, dialAttempts: 1}, nil
+	}
+	if err != context.DeadlineExceeded {
+		return nil, err
+	}
+	unreachable := fmt.Errorf("dial %s: %w", address, err)
+
+	conn, err = grpc.DialContext(context.Background(), address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{
+		address:      address,
+		conn:         conn,
+		healthy:      false,
+		dialAttempts: 1,
+		lastError:    unreachable,
+	}, nil
+}
+
+// next returns the next healthy endpoint in round-robin order, skipping
+// over unhealthy ones. If every endpoint is currently unhealthy it returns
+// errNoHealthyEndpoints so callers can surface a clear error rather than
+// silently pinning to a dead connection.
+func (b *balancer) next() (*endpoint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := 0; i < len(b.endpoints); i++ {
+		idx := (b.cursor + i) % len(b.endpoints)
+		ep := b.endpoints[idx]
+		ep.mu.Lock()
+		healthy := ep.healthy
+		ep.mu.Unlock()
+		if healthy {
+			b.cursor = (idx + 1) % len(b.endpoints)
+			return ep, nil
+		}
+	}
+	return nil, errNoHealthyEndpoints
+}
+
+// statuses returns a snapshot of every endpoint's health and metrics.
+func (b *balancer) statuses() []EndpointStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]EndpointStatus, 0, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		out = append(out, ep.status())
+	}
+	return out
+}
+
+// probeLoop periodically re-checks unhealthy endpoints with a lightweight
+// DiscoveryRequest so they can rejoin the rotation once the origin
+// recovers, without waiting for a caller to open a new stream against
+// them.
+func (b *balancer) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.probeUnhealthy(ctx)
+		}
+	}
+}
+
+// probeUnhealthy fires off b.healthz against every currently-unhealthy
+// endpoint, split out of probeLoop so it can be driven directly by tests
+// without waiting on a real healthCheckInterval tick.
+func (b *balancer) probeUnhealthy(ctx context.Context) {
+	b.mu.Lock()
+	endpoints := append([]*endpoint{}, b.endpoints...)
+	b.mu.Unlock()
+	for _, ep := range endpoints {
+		ep.mu.Lock()
+		healthy := ep.healthy
+		ep.mu.Unlock()
+		if !healthy {
+			go b.healthz(ctx, ep)
+		}
+	}
+}
+
+// healthCheckNodeID identifies xds-relay itself to the origin on a health
+// probe stream, distinguishing probe traffic from real downstream requests
+// in origin-side logs/metrics.
+const healthCheckNodeID = "xds-relay-health-check"
+
+// probeV2 and probeV3 below only wait on opening a stream and sending a
+// request on it, not on a response: healthCheckNodeID is a synthetic node ID
+// that no real snapshot is ever keyed to, so the origin has nothing to send
+// back and a response may never come. A stream the origin accepted a
+// request on is as strong a reachability signal as this probe can get
+// without real content to ask for, and it's enough to distinguish "endpoint
+// is back up" from "endpoint is still refusing connections/RPCs".
+
+func probeV2(ctx context.Context, ep *endpoint) {
+	probeCtx, cancel := context.WithTimeout(ctx, healthCheckInterval)
+	defer cancel()
+
+	client := discoveryv2.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := client.StreamAggregatedResources(probeCtx)
+	if err != nil {
+		ep.markUnhealthy(err)
+		return
+	}
+	defer stream.CloseSend()
+
+	err = stream.Send(&v2.DiscoveryRequest{
+		TypeUrl: ClusterTypeURL,
+		Node:    &corev2.Node{Id: healthCheckNodeID},
+	})
+	if err != nil {
+		ep.markUnhealthy(err)
+		return
+	}
+
+	ep.markHealthy()
+}
+
+func probeV3(ctx context.Context, ep *endpoint) {
+	probeCtx, cancel := context.WithTimeout(ctx, healthCheckInterval)
+	defer cancel()
+
+	client := discoveryv3.NewAggregatedDiscoveryServiceClient(ep.conn)
+	stream, err := client.StreamAggregatedResources(probeCtx)
+	if err != nil {
+		ep.markUnhealthy(err)
+		return
+	}
+	defer stream.CloseSend()
+
+	err = stream.Send(&discoveryv3.DiscoveryRequest{
+		TypeUrl: TypeURL(V3, ClusterResource),
+		Node:    &corev3.Node{Id: healthCheckNodeID},
+	})
+	if err != nil {
+		ep.markUnhealthy(err)
+		return
+	}
+
+	ep.markHealthy()
+}
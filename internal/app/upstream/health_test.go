@@ -0,0 +1,109 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBalancer(endpoints ...*endpoint) *balancer {
+	return &balancer{endpoints: endpoints, ready: make(chan struct{})}
+}
+
+func TestNextRoundRobinsAcrossHealthyEndpoints(t *testing.T) {
+	a := &endpoint{address: "a", healthy: true}
+	b := &endpoint{address: "b", healthy: true}
+	bal := newTestBalancer(a, b)
+
+	first, err := bal.next()
+	require.NoError(t, err)
+	second, err := bal.next()
+	require.NoError(t, err)
+	third, err := bal.next()
+	require.NoError(t, err)
+
+	assert.Equal(t, a, first)
+	assert.Equal(t, b, second)
+	assert.Equal(t, a, third)
+}
+
+func TestNextSkipsUnhealthyEndpoints(t *testing.T) {
+	a := &endpoint{address: "a", healthy: false}
+	b := &endpoint{address: "b", healthy: true}
+	bal := newTestBalancer(a, b)
+
+	got, err := bal.next()
+	require.NoError(t, err)
+	assert.Equal(t, b, got)
+}
+
+func TestNextReturnsErrorWhenNoEndpointsAreHealthy(t *testing.T) {
+	a := &endpoint{address: "a", healthy: false}
+	bal := newTestBalancer(a)
+
+	_, err := bal.next()
+	assert.Equal(t, errNoHealthyEndpoints, err)
+}
+
+func TestMarkUnhealthyRemovesEndpointFromRotation(t *testing.T) {
+	a := &endpoint{address: "a", healthy: true}
+	b := &endpoint{address: "b", healthy: true}
+	bal := newTestBalancer(a, b)
+
+	a.markUnhealthy(errors.New("boom"))
+
+	got, err := bal.next()
+	require.NoError(t, err)
+	assert.Equal(t, b, got)
+	assert.False(t, a.status().Healthy)
+	assert.Equal(t, "boom", a.status().LastError.Error())
+}
+
+func TestMarkHealthyReturnsEndpointToRotation(t *testing.T) {
+	a := &endpoint{address: "a", healthy: false}
+	bal := newTestBalancer(a)
+
+	_, err := bal.next()
+	assert.Equal(t, errNoHealthyEndpoints, err)
+
+	a.markHealthy()
+
+	got, err := bal.next()
+	require.NoError(t, err)
+	assert.Equal(t, a, got)
+}
+
+func TestIsRetryableGRPCError(t *testing.T) {
+	assert.False(t, isRetryableGRPCError(nil))
+	assert.True(t, isRetryableGRPCError(errors.New("not a grpc status")))
+}
+
+func TestProbeUnhealthyOnlyProbesUnhealthyEndpoints(t *testing.T) {
+	healthy := &endpoint{address: "healthy", healthy: true}
+	unhealthy := &endpoint{address: "unhealthy", healthy: false}
+
+	var mu sync.Mutex
+	var probed []string
+	probe := func(ctx context.Context, ep *endpoint) {
+		mu.Lock()
+		probed = append(probed, ep.address)
+		mu.Unlock()
+		ep.markHealthy()
+	}
+
+	bal := &balancer{endpoints: []*endpoint{healthy, unhealthy}, healthz: probe, ready: make(chan struct{})}
+
+	bal.probeUnhealthy(context.Background())
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(probed) == 1 && probed[0] == "unhealthy"
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, unhealthy.status().Healthy)
+}
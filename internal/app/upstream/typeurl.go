@@ -0,0 +1,67 @@
+package upstream
+
+// Version identifies an xDS wire version. xds-relay keeps v2 and v3
+// resources keyed separately throughout the aggregation layer so that a
+// single relay instance can originate and terminate both.
+type Version string
+
+const (
+	// V2 is the xDS v2 transport (envoy.api.v2).
+	V2 Version = "v2"
+	// V3 is the xDS v3 transport (envoy.service.discovery.v3).
+	V3 Version = "v3"
+)
+
+// Resource identifies an xDS resource kind independent of wire version
+// (cluster, endpoint, listener, route, secret).
+type Resource string
+
+const (
+	ClusterResource  Resource = "cluster"
+	EndpointResource Resource = "endpoint"
+	ListenerResource Resource = "listener"
+	RouteResource    Resource = "route"
+	SecretResource   Resource = "secret"
+)
+
+// typeURLs maps a (version, resource) pair to the protobuf type URL used on
+// the wire. This is the single place that needs updating when a new xDS
+// version or resource kind is added; every other package should look up
+// type URLs through this registry instead of hardcoding strings.
+var typeURLs = map[Version]map[Resource]string{
+	V2: {
+		ClusterResource:  "type.googleapis.com/envoy.api.v2.Cluster",
+		EndpointResource: "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment",
+		ListenerResource: "type.googleapis.com/envoy.api.v2.Listener",
+		RouteResource:    "type.googleapis.com/envoy.api.v2.RouteConfiguration",
+		SecretResource:   "type.googleapis.com/envoy.api.v2.auth.Secret",
+	},
+	V3: {
+		ClusterResource:  "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+		EndpointResource: "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment",
+		ListenerResource: "type.googleapis.com/envoy.config.listener.v3.Listener",
+		RouteResource:    "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+		SecretResource:   "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret",
+	},
+}
+
+// TypeURL returns the wire type URL for the given version and resource.
+// It panics if the pair is not registered, since that indicates a
+// programming error rather than a runtime condition callers can recover
+// from.
+func TypeURL(version Version, resource Resource) string {
+	byResource, ok := typeURLs[version]
+	if !ok {
+		panic("upstream: unknown xDS version " + string(version))
+	}
+	typeURL, ok := byResource[resource]
+	if !ok {
+		panic("upstream: unknown resource " + string(resource) + " for version " + string(version))
+	}
+	return typeURL
+}
+
+// ClusterTypeURL is retained for backwards compatibility with callers that
+// only ever spoke v2; new code should call TypeURL(V2, ClusterResource)
+// explicitly.
+const ClusterTypeURL = "type.googleapis.com/envoy.api.v2.Cluster"
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+// mockLogger is a Logger implementation that writes to stdout with
+// fmt.Printf semantics. It is intended for use in tests where a fully
+// configured zap logger is unnecessary ceremony.
+type mockLogger struct {
+	name string
+}
+
+// MockLogger is a ready-to-use Logger for tests.
+var MockLogger Logger = &mockLogger{}
+
+func (l *mockLogger) prefix() string {
+	if l.name == "" {
+		return ""
+	}
+	return "[" + l.name + "] "
+}
+
+func (l *mockLogger) With(key string, value interface{}) Logger {
+	return l
+}
+
+func (l *mockLogger) Named(name string) Logger {
+	if l.name == "" {
+		return &mockLogger{name: name}
+	}
+	return &mockLogger{name: l.name + "." + name}
+}
+
+func (l *mockLogger) Debug(ctx context.Context, format string, args ...interface{}) {
+	fmt.Printf(l.prefix()+"DEBUG "+format+"\n", args...)
+}
+
+func (l *mockLogger) Info(ctx context.Context, format string, args ...interface{}) {
+	fmt.Printf(l.prefix()+"INFO "+format+"\n", args...)
+}
+
+func (l *mockLogger) Warn(ctx context.Context, format string, args ...interface{}) {
+	fmt.Printf(l.prefix()+"WARN "+format+"\n", args...)
+}
+
+func (l *mockLogger) Error(ctx context.Context, format string, args ...interface{}) {
+	fmt.Printf(l.prefix()+"ERROR "+format+"\n", args...)
+}
+
+func (l *mockLogger) Fatal(ctx context.Context, format string, args ...interface{}) {
+	panic(fmt.Sprintf(l.prefix()+"FATAL "+format, args...))
+}
@@ -0,0 +1,19 @@
+// Package service defines the lifecycle interface every long-running
+// component of xds-relay (the downstream gRPC server, the upstream
+// client's health monitor, the admin HTTP server) adopts, so the relay's
+// top-level composition can start them uniformly and learn uniformly how
+// and why any of them exited.
+package service
+
+import "context"
+
+// Service is a component with its own run loop. Serve blocks until ctx is
+// canceled or the component suffers a fatal error, and returns that error
+// (nil on a clean, context-caused shutdown). Ready is closed once the
+// component has finished initializing and is handling its work -- for a
+// server that means its listener is bound, for a background monitor that
+// it's taken its first observation.
+type Service interface {
+	Serve(ctx context.Context) error
+	Ready() <-chan struct{}
+}
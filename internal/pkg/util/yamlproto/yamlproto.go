@@ -0,0 +1,23 @@
+// Package yamlproto converts the relay's YAML-authored configuration files
+// (bootstrap and aggregation keyer rules) into their in-memory
+// representations.
+package yamlproto
+
+import (
+	"gopkg.in/yaml.v2"
+
+	aggregationv1 "github.com/envoyproxy/xds-relay/pkg/api/aggregation/v1"
+	bootstrapv1 "github.com/envoyproxy/xds-relay/pkg/api/bootstrap/v1"
+)
+
+// FromYAMLToBootstrapConfiguration unmarshals the contents of a bootstrap
+// config file into the given Bootstrap message.
+func FromYAMLToBootstrapConfiguration(content string, bootstrap *bootstrapv1.Bootstrap) error {
+	return yaml.Unmarshal([]byte(content), bootstrap)
+}
+
+// FromYAMLToKeyerConfiguration unmarshals the contents of an aggregation
+// rules file into the given KeyerConfiguration message.
+func FromYAMLToKeyerConfiguration(content string, keyerConfiguration *aggregationv1.KeyerConfiguration) error {
+	return yaml.Unmarshal([]byte(content), keyerConfiguration)
+}
@@ -0,0 +1,66 @@
+// Package v1 defines the aggregation key configuration schema, i.e. the
+// rules that determine how incoming discovery requests are bucketed into
+// cache entries that can be shared across downstream Envoys.
+package v1
+
+import "strings"
+
+// KeyerConfiguration is an ordered list of fragment rules used to compute
+// an aggregation key for an incoming discovery request. The first matching
+// rule wins.
+type KeyerConfiguration struct {
+	Fragments []*KeyerConfiguration_Fragment `json:"fragments,omitempty" yaml:"fragments,omitempty"`
+}
+
+// Resolve computes the aggregation key a request of the given type URL
+// maps to: the first Fragment all of whose Rules match contributes its
+// key, built by joining each matching Rule's ResultFragment. A Rule whose
+// RequestTypeMatch is empty matches any request type. If no Fragment
+// matches -- including when k is nil, i.e. no keyer configuration was
+// supplied -- Resolve falls back to nodeID, so the request still lands in
+// a (trivially unshared, one-node-per-entry) cache entry rather than
+// being rejected.
+func (k *KeyerConfiguration) Resolve(requestType, nodeID string) string {
+	if k == nil {
+		return nodeID
+	}
+	for _, fragment := range k.Fragments {
+		if key, ok := fragment.resolve(requestType); ok {
+			return key
+		}
+	}
+	return nodeID
+}
+
+// resolve reports the key this fragment contributes for requestType, and
+// whether every one of its rules matched.
+func (f *KeyerConfiguration_Fragment) resolve(requestType string) (string, bool) {
+	if len(f.Rules) == 0 {
+		return "", false
+	}
+	parts := make([]string, 0, len(f.Rules))
+	for _, rule := range f.Rules {
+		if rule.RequestTypeMatch != "" && rule.RequestTypeMatch != requestType {
+			return "", false
+		}
+		parts = append(parts, rule.ResultFragment)
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// KeyerConfiguration_Fragment is a single aggregation rule.
+//
+//nolint:golint,stylecheck
+type KeyerConfiguration_Fragment struct {
+	Rules []*KeyerConfiguration_Fragment_MatchPredicate `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// KeyerConfiguration_Fragment_MatchPredicate matches a discovery request by
+// request type and/or node metadata, and contributes a fragment of the
+// resulting aggregation key when it matches.
+//
+//nolint:golint,stylecheck
+type KeyerConfiguration_Fragment_MatchPredicate struct {
+	RequestTypeMatch string `json:"requestTypeMatch,omitempty" yaml:"requestTypeMatch,omitempty"`
+	ResultFragment   string `json:"resultFragment,omitempty" yaml:"resultFragment,omitempty"`
+}
@@ -0,0 +1,43 @@
+// Package v1 defines the bootstrap configuration schema for xds-relay,
+// i.e. the config that describes how the relay server itself should run
+// (listen address, originating upstream, logging).
+package v1
+
+// Bootstrap is the top level bootstrap configuration for an xds-relay
+// instance.
+type Bootstrap struct {
+	// Server describes the downstream-facing xDS server that Envoys connect to.
+	Server *Server `json:"server,omitempty" yaml:"server,omitempty"`
+	// OriginServer describes the upstream management server(s) that xds-relay
+	// aggregates from.
+	OriginServer *OriginServer `json:"originServer,omitempty" yaml:"originServer,omitempty"`
+	// Logging configures the relay's log level and output format.
+	Logging *Logging `json:"logging,omitempty" yaml:"logging,omitempty"`
+}
+
+// Server describes an xDS server's bind address.
+type Server struct {
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	Port    uint32 `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// OriginServer describes the set of upstream management server endpoints
+// that xds-relay originates requests to.
+type OriginServer struct {
+	Cluster []*Locality `json:"cluster,omitempty" yaml:"cluster,omitempty"`
+}
+
+// Locality groups upstream endpoints that should be treated as equally
+// preferred by the upstream client's load balancing.
+type Locality struct {
+	Name      string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Endpoints []*Server `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
+// Logging configures the structured logger used throughout the relay.
+type Logging struct {
+	// Level is one of "debug", "info", "warn", "error".
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Format is one of "json" (production) or "console" (local development).
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+}